@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/i2bskn/master-import/masterimport"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const configFileName = masterimport.AppName + ".yml"
+
+// environmentName selects a named environment of the configuration file.
+var environmentName string
+
+// Environment holds the settings of a named environment in the
+// configuration file.
+type Environment struct {
+	Driver   string            `yaml:"driver"`
+	Host     string            `yaml:"host"`
+	Port     string            `yaml:"port"`
+	Socket   string            `yaml:"socket"`
+	Name     string            `yaml:"db"`
+	User     string            `yaml:"user"`
+	Password string            `yaml:"password"`
+	Params   map[string]string `yaml:"params"`
+	SSLMode  string            `yaml:"ssl-mode"`
+	SSLCA    string            `yaml:"ssl-ca"`
+	SSLCert  string            `yaml:"ssl-cert"`
+	SSLKey   string            `yaml:"ssl-key"`
+	BaseDir  string            `yaml:"basedir"`
+	Tables   []string          `yaml:"tables"`
+}
+
+// configFilePath returns the first configuration file found in the current
+// directory or the home directory.
+func configFilePath() (string, error) {
+	dirs := make([]string, 0, 2)
+	if current, err := os.Getwd(); err == nil {
+		dirs = append(dirs, current)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", usageErrorf("Configuration file not found: %s", configFileName)
+}
+
+// LoadEnvironment reads the environment named name from the configuration
+// file.
+func LoadEnvironment(name string) (*Environment, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	environments := make(map[string]*Environment)
+	if err := yaml.Unmarshal(bytes, &environments); err != nil {
+		return nil, &masterimport.ParseError{File: path, Err: err}
+	}
+
+	env, ok := environments[name]
+	if !ok || env == nil {
+		return nil, usageErrorf("Environment %s not found in %s", name, path)
+	}
+
+	if len(env.BaseDir) > 0 && !filepath.IsAbs(env.BaseDir) {
+		env.BaseDir = filepath.Join(filepath.Dir(path), env.BaseDir)
+	}
+	return env, nil
+}
+
+// Apply sets every value of the environment on the database and source
+// settings, except for those given explicitly as flags.
+func (env *Environment) Apply(flags *flag.FlagSet, database *masterimport.Database, basedir, tableStr *string) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := []struct {
+		flag  string
+		value string
+		dest  *string
+	}{
+		{"driver", env.Driver, &database.Driver},
+		{"host", env.Host, &database.Host},
+		{"port", env.Port, &database.Port},
+		{"socket", env.Socket, &database.Socket},
+		{"db", env.Name, &database.Name},
+		{"user", env.User, &database.User},
+		{"password", env.Password, &database.Password},
+		{"ssl-mode", env.SSLMode, &database.SSLMode},
+		{"ssl-ca", env.SSLCA, &database.SSLCA},
+		{"ssl-cert", env.SSLCert, &database.SSLCert},
+		{"ssl-key", env.SSLKey, &database.SSLKey},
+		{"basedir", env.BaseDir, basedir},
+		{"tables", strings.Join(env.Tables, tableNameDelimiter), tableStr},
+	}
+	for _, v := range values {
+		if !set[v.flag] && len(v.value) > 0 {
+			*v.dest = v.value
+		}
+	}
+
+	if len(env.Params) > 0 {
+		params := make(map[string]string)
+		for key, value := range env.Params {
+			params[key] = value
+		}
+		for key, value := range database.Params {
+			params[key] = value
+		}
+		database.Params = params
+	}
+}
+
+// applyEnvironment applies the environment selected with -env, if any.
+func applyEnvironment(flags *flag.FlagSet, database *masterimport.Database, basedir, tableStr *string) error {
+	if len(environmentName) == 0 {
+		return nil
+	}
+
+	env, err := LoadEnvironment(environmentName)
+	if err != nil {
+		return err
+	}
+
+	env.Apply(flags, database, basedir, tableStr)
+	return nil
+}
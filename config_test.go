@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/i2bskn/master-import/masterimport"
+)
+
+const testConfig = `
+production:
+  driver: mysql
+  host: db.example.com
+  db: master
+  params:
+    charset: utf8mb4
+    tls: "true"
+  basedir: master
+  tables:
+    - items
+    - users
+empty:
+`
+
+func TestLoadEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, configFileName), []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	env, err := LoadEnvironment("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Host != "db.example.com" || env.Name != "master" {
+		t.Errorf("host, db = %q, %q, want db.example.com, master", env.Host, env.Name)
+	}
+	if want := filepath.Join(dir, "master"); env.BaseDir != want {
+		t.Errorf("basedir = %q, want %q", env.BaseDir, want)
+	}
+
+	for _, name := range []string{"empty", "staging"} {
+		if _, err := LoadEnvironment(name); err == nil {
+			t.Errorf("environment %s: expected an error", name)
+		}
+	}
+}
+
+func TestEnvironmentApply(t *testing.T) {
+	env := &Environment{
+		Driver:  "mysql",
+		Host:    "db.example.com",
+		User:    "app",
+		Params:  map[string]string{"charset": "utf8mb4", "tls": "true"},
+		BaseDir: "/srv/master",
+		Tables:  []string{"items", "users"},
+	}
+
+	var basedir, tableStr string
+	options := masterimport.DefaultOptions()
+	database := &masterimport.Database{Params: map[string]string{"tls": "skip-verify"}}
+	flags := flag.NewFlagSet(masterimport.AppName, flag.ContinueOnError)
+	flags.StringVar(&database.Host, "host", "localhost", "")
+	flags.StringVar(&database.User, "user", "root", "")
+	setSourceFlags(flags, &options, &basedir, &tableStr)
+	if err := flags.Parse([]string{"-user", "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env.Apply(flags, database, &basedir, &tableStr)
+
+	if database.Host != "db.example.com" || database.User != "admin" {
+		t.Errorf("host, user = %q, %q, want db.example.com, admin", database.Host, database.User)
+	}
+	if basedir != "/srv/master" || tableStr != "items,users" {
+		t.Errorf("basedir, tables = %q, %q, want /srv/master, items,users", basedir, tableStr)
+	}
+	if want := map[string]string{"charset": "utf8mb4", "tls": "skip-verify"}; !reflect.DeepEqual(database.Params, want) {
+		t.Errorf("params = %v, want %v", database.Params, want)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/i2bskn/master-import/masterimport"
+	"golang.org/x/term"
+)
+
+// askPassword enables the password prompt.
+var askPassword bool
+
+// readPassword prompts for a password on the terminal without echoing it.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("Password prompt requires a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// resolveCredentials completes the credentials of database after flags and
+// the configuration file are applied, prompting for the password when
+// askPassword is set and no password was found.
+func resolveCredentials(database *masterimport.Database) error {
+	if err := database.ResolveCredentials(); err != nil {
+		return err
+	}
+
+	if askPassword && len(database.Password) == 0 {
+		password, err := readPassword("Enter password: ")
+		if err != nil {
+			return err
+		}
+		database.Password = password
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/i2bskn/master-import/masterimport"
+)
+
+func runDiff(args []string) error {
+	var basedir, tableStr string
+	var jsonOutput bool
+	database := masterimport.NewDatabase()
+	options := masterimport.DefaultOptions()
+
+	flags := flag.NewFlagSet(masterimport.AppName+" diff", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+
+	setDatabaseFlags(flags, database)
+	setSourceFlags(flags, &options, &basedir, &tableStr)
+	flags.BoolVar(&jsonOutput, "json", false, "print differences as JSON")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := applyEnvironment(flags, database, &basedir, &tableStr); err != nil {
+		return err
+	}
+	if err := resolveCredentials(database); err != nil {
+		return err
+	}
+
+	setSources(&options, basedir, tableStr)
+	if err := options.Check(); err != nil {
+		return err
+	}
+
+	dataSources, err := masterimport.SelectDataSources(options)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	diffs := make([]masterimport.TableDiff, 0, len(dataSources))
+	changed := false
+	for _, dataSource := range dataSources {
+		diff, err := database.DiffTable(ctx, dataSource)
+		if err != nil {
+			return err
+		}
+		diffs = append(diffs, diff)
+		changed = changed || diff.HasChanges()
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diffs); err != nil {
+			return err
+		}
+	} else {
+		masterimport.WriteDiffText(os.Stdout, diffs)
+	}
+
+	if changed {
+		return errDifferences
+	}
+	return nil
+}
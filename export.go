@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/i2bskn/master-import/masterimport"
+)
+
+func runExport(args []string) error {
+	var basedir, tableStr string
+	database := masterimport.NewDatabase()
+	format := masterimport.FormatJSON
+
+	flags := flag.NewFlagSet(masterimport.AppName+" export", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+
+	setDatabaseFlags(flags, database)
+
+	flags.StringVar(&basedir, "basedir", "", "base directory")
+	flags.StringVar(&tableStr, "tables", "", "target tables")
+	flags.StringVar(&format, "format", format, "output format (json, yaml, ndjson, csv or tsv)")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := applyEnvironment(flags, database, &basedir, &tableStr); err != nil {
+		return err
+	}
+	if err := resolveCredentials(database); err != nil {
+		return err
+	}
+
+	switch format {
+	case masterimport.FormatJSON, masterimport.FormatYAML, masterimport.FormatNDJSON, masterimport.FormatCSV, masterimport.FormatTSV:
+	default:
+		return usageErrorf("invalid format: %s", format)
+	}
+
+	baseDir, err := masterimport.ResolveBaseDir(basedir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	names := make([]string, 0, 0)
+	if len(tableStr) > 0 {
+		names = strings.Split(tableStr, tableNameDelimiter)
+	} else {
+		tableNames, err := database.TableNames(ctx)
+		if err != nil {
+			return err
+		}
+		names = tableNames
+	}
+
+	for _, name := range names {
+		if err := database.ExportTable(ctx, baseDir, name, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,531 +1,286 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"math"
 	"os"
-	"os/user"
-	"path/filepath"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/i2bskn/master-import/masterimport"
 )
 
-const (
-	AppName            = "master-import"
-	defaultBaseDirName = "master"
-	tableNameDelimiter = ","
-	extDelimiter       = "."
-)
-
-const (
-	driverName    = "mysql"
-	defaultHost   = "localhost"
-	defaultPort   = "3306"
-	defaultSocket = "/tmp/mysql.sock"
-)
+const tableNameDelimiter = ","
 
 const (
 	ExitCodeOK = iota
 	ExitCodeError
+	ExitCodeDiff
+	ExitCodeUsage
+	ExitCodeSourceNotFound
+	ExitCodeParse
+	ExitCodeValidation
+	ExitCodeConnection
+	ExitCodeSQL
 )
 
-var (
-	queryValueSize int = 3
-)
+// errDifferences is returned by the diff command when the database
+// differs from the sources. It is reported by the exit code alone.
+var errDifferences = errors.New("Differences found")
 
-type StringValue struct {
-	Values map[int]string
-}
+func main() {
+	var err error
 
-func NewStringValue() StringValue {
-	return StringValue{
-		Values: make(map[int]string),
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
 	}
-}
 
-func (sv StringValue) SetValue(index int, arg interface{}) error {
-	var value string
-	switch arg.(type) {
-	case string:
-		value = strings.Join([]string{"\"", arg.(string), "\""}, "")
-	case int, float64:
-		value = fmt.Sprint(arg)
-	case nil:
-		value = "NULL"
+	switch command {
+	case "export":
+		err = runExport(args[1:])
+	case "diff":
+		err = runDiff(args[1:])
+	case "import":
+		err = runImport(args[1:])
 	default:
-		return fmt.Errorf("Unexpected value: %v", arg)
+		err = runImport(args)
 	}
 
-	sv.Values[index] = value
-	return nil
-}
-
-type DataSource struct {
-	Source       string
-	TableName    string
-	sourceFiles  []string
-	columnNames  map[int]string
-	stringValues []StringValue
-}
-
-func NewDataSource(source string) (*DataSource, error) {
-	abs, err := filepath.Abs(source)
-	if err != nil {
-		return nil, err
+	if err == flag.ErrHelp {
+		os.Exit(ExitCodeOK)
 	}
-
-	baseName := filepath.Base(abs)
-	elements := strings.Split(baseName, extDelimiter)
-	tableName := elements[0]
-
-	return &DataSource{
-		Source:      abs,
-		TableName:   tableName,
-		columnNames: make(map[int]string),
-	}, nil
-}
-
-func (ds *DataSource) SourceFiles() ([]string, error) {
-	if len(ds.sourceFiles) == 0 {
-		src, err := os.Stat(ds.Source)
-		if err != nil {
-			return []string{}, fmt.Errorf("Source not found: %s", ds.Source)
-		}
-
-		if src.IsDir() {
-			pattern := filepath.Join(ds.Source, "*.json")
-			matches, err := filepath.Glob(pattern)
-			if err != nil {
-				return matches, err
-			}
-			if len(matches) == 0 {
-				return matches, fmt.Errorf("Empty source: %s", ds.Source)
-			}
-			ds.sourceFiles = matches
-			return matches, nil
-		}
-
-		ds.sourceFiles = []string{ds.Source}
+	if err != nil && err != errDifferences && len(err.Error()) > 0 {
+		fmt.Fprintln(os.Stderr, err)
 	}
-
-	return ds.sourceFiles, nil
+	os.Exit(exitCode(err))
 }
 
-func (ds *DataSource) ColumnNames() (map[int]string, error) {
-	if len(ds.columnNames) == 0 {
-		sources, err := ds.SourceFiles()
-		if err != nil {
-			return ds.columnNames, err
-		}
-
-		for _, source := range sources {
-			bytes, err := ioutil.ReadFile(source)
-			if err != nil {
-				return ds.columnNames, err
-			}
-
-			data := make(map[string]interface{})
-			err = json.Unmarshal(bytes, &data)
-			if err != nil {
-				return ds.columnNames, err
-			}
-
-			idx := 0
-			for name, _ := range data {
-				ds.columnNames[idx] = name
-				idx++
-			}
-			break
-		}
-	}
-
-	return ds.columnNames, nil
+// exitCode returns the exit code reporting err.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+	if errors.Is(err, errDifferences) {
+		return ExitCodeDiff
+	}
+
+	var (
+		usageErr      *masterimport.UsageError
+		notFoundErr   *masterimport.SourceNotFoundError
+		parseErr      *masterimport.ParseError
+		validationErr *masterimport.ValidationError
+		connectionErr *masterimport.ConnectionError
+		sqlErr        *masterimport.SQLError
+	)
+	switch {
+	case errors.As(err, &usageErr):
+		return ExitCodeUsage
+	case errors.As(err, &notFoundErr):
+		return ExitCodeSourceNotFound
+	case errors.As(err, &parseErr):
+		return ExitCodeParse
+	case errors.As(err, &validationErr):
+		return ExitCodeValidation
+	case errors.As(err, &connectionErr):
+		return ExitCodeConnection
+	case errors.As(err, &sqlErr):
+		return ExitCodeSQL
+	}
+	return ExitCodeError
 }
 
-func (ds *DataSource) StringValues() ([]StringValue, error) {
-	if len(ds.stringValues) == 0 {
-		sources, err := ds.SourceFiles()
-		if err != nil {
-			return ds.stringValues, err
-		}
-
-		names, err := ds.ColumnNames()
-		if err != nil {
-			return ds.stringValues, err
-		}
-
-		for _, source := range sources {
-			bytes, err := ioutil.ReadFile(source)
-			if err != nil {
-				return ds.stringValues, err
-			}
-
-			data := make(map[string]interface{})
-			err = json.Unmarshal(bytes, &data)
-			if err != nil {
-				return ds.stringValues, err
-			}
-
-			stringValue := NewStringValue()
-			for i, name := range names {
-				stringValue.SetValue(i, data[name])
-			}
-
-			ds.stringValues = append(ds.stringValues, stringValue)
-		}
-	}
-
-	return ds.stringValues, nil
+func usageErrorf(format string, args ...interface{}) error {
+	return &masterimport.UsageError{Message: fmt.Sprintf(format, args...)}
 }
 
-type QueryBuilder struct {
-	dataSource *DataSource
+// paramsFlag collects repeated -param key=value flags into Params.
+type paramsFlag struct {
+	database *masterimport.Database
 }
 
-func NewQueryBuilder(dataSource *DataSource) QueryBuilder {
-	return QueryBuilder{
-		dataSource: dataSource,
-	}
+func (f paramsFlag) String() string {
+	return ""
 }
 
-func (builder *QueryBuilder) sqlColumns() (string, error) {
-	var sqlElement string
-
-	columnNames, err := builder.dataSource.ColumnNames()
-	if err != nil {
-		return sqlElement, err
-	}
-
-	if len(columnNames) > 0 {
-		sqlElement = columnNames[0]
-		for i := 1; i < len(columnNames); i++ {
-			sqlElement += ", " + columnNames[i]
-		}
-		return fmt.Sprintf("(%s)", sqlElement), nil
+func (f paramsFlag) Set(value string) error {
+	elements := strings.SplitN(value, "=", 2)
+	if len(elements) != 2 || len(elements[0]) == 0 {
+		return fmt.Errorf("expected key=value: %s", value)
 	}
 
-	return sqlElement, fmt.Errorf("Column names can not acquired: %s", builder.dataSource.TableName)
+	f.database.SetParam(elements[0], elements[1])
+	return nil
 }
 
-func (builder *QueryBuilder) sqlValues() ([]string, error) {
-	sqlElements := make([]string, 0, 0)
-
-	stringValues, err := builder.dataSource.StringValues()
-	if err != nil {
-		return sqlElements, err
-	}
-
-	for _, stringValue := range stringValues {
-		var sqlElement string
-
-		for i := 0; i < len(stringValue.Values); i++ {
-			if i == 0 {
-				sqlElement = stringValue.Values[i]
-			} else {
-				sqlElement += ", " + stringValue.Values[i]
-			}
-		}
-
-		sqlElements = append(sqlElements, fmt.Sprintf("(%s)", sqlElement))
-	}
-
-	return sqlElements, nil
+func setDatabaseFlags(flags *flag.FlagSet, database *masterimport.Database) {
+	flags.StringVar(&database.Driver, "driver", database.Driver, "database driver (mysql, postgres or sqlite3)")
+	flags.StringVar(&database.Host, "host", "", "database hostname")
+	flags.StringVar(&database.Port, "port", "", "database port")
+	flags.StringVar(&database.Socket, "socket", "", "database socket")
+	flags.StringVar(&database.Name, "db", "", "database name")
+	flags.StringVar(&database.User, "user", "", "database user")
+	flags.StringVar(&database.Password, "password", "", "database password")
+	flags.Var(paramsFlag{database}, "param", "DSN parameter as key=value (repeatable)")
+	flags.StringVar(&database.SSLMode, "ssl-mode", "", "SSL mode (DISABLED, PREFERRED, REQUIRED, VERIFY_CA or VERIFY_IDENTITY)")
+	flags.StringVar(&database.SSLCA, "ssl-ca", "", "CA certificate file")
+	flags.StringVar(&database.SSLCert, "ssl-cert", "", "client certificate file")
+	flags.StringVar(&database.SSLKey, "ssl-key", "", "client key file")
+	flags.StringVar(&database.DefaultsFile, "defaults-file", "", "read [client] options from this file instead of ~/"+masterimport.OptionFileName)
+	flags.BoolVar(&askPassword, "ask-password", false, "prompt for the password when none is found")
+	flags.StringVar(&environmentName, "env", "", "environment of "+configFileName+" to read settings from")
 }
 
-func (builder QueryBuilder) TruncateQuery() string {
-	return fmt.Sprintf("TRUNCATE TABLE %s", builder.dataSource.TableName)
+func setSourceFlags(flags *flag.FlagSet, options *masterimport.Options, basedir, tableStr *string) {
+	flags.StringVar(basedir, "basedir", "", "base directory")
+	flags.StringVar(tableStr, "tables", "", "target tables")
+	flags.StringVar(&options.ColumnMode, "columns", options.ColumnMode, "column consistency mode (strict or union)")
+	flags.BoolVar(&options.CSVEmptyAsNull, "csv-empty-null", options.CSVEmptyAsNull, "treat empty CSV/TSV cells as NULL")
 }
 
-func (builder QueryBuilder) InsertQueries() (map[int]string, error) {
-	queries := make(map[int]string)
-	table := builder.dataSource.TableName
-	sqlColumns, err := builder.sqlColumns()
-	if err != nil {
-		return queries, err
+// parseFlags parses args. Errors other than flag.ErrHelp are returned as a
+// UsageError without a message, since the flag set prints them itself.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return &masterimport.UsageError{}
 	}
-
-	sqlValues, err := builder.sqlValues()
-	if err != nil {
-		return queries, err
-	}
-
-	insertQuerySize := int(math.Ceil(float64(len(sqlValues)) / float64(queryValueSize)))
-	for i := 0; i < insertQuerySize; i++ {
-		f := queryValueSize * i
-		l := queryValueSize * (i + 1)
-		if l > len(sqlValues) {
-			l = len(sqlValues)
-		}
-		values := strings.Join(sqlValues[f:l], ",")
-		queries[i] = fmt.Sprintf("INSERT INTO %s %s VALUES %s", table, sqlColumns, values)
-	}
-	return queries, err
+	return err
 }
 
-type Database struct {
-	Host           string
-	Port           string
-	Socket         string
-	Name           string
-	User           string
-	Password       string
-	Params         map[string]string
-	dataSourceName string
+// setSources sets the base directory and the tables of options from the
+// -basedir and -tables flags.
+func setSources(options *masterimport.Options, basedir, tableStr string) {
+	options.BaseDir = basedir
+	if len(tableStr) > 0 {
+		options.Tables = strings.Split(tableStr, tableNameDelimiter)
+	}
 }
 
-func NewDatabase() *Database {
-	return &Database{}
-}
+func runImport(args []string) error {
+	var basedir, tableStr, primaryKeyStr, dryRunFile, output, timeZoneName string
+	var dryRun bool
+	database := masterimport.NewDatabase()
+	options := masterimport.DefaultOptions()
 
-func (db *Database) LoadWithTransaction(dataSource *DataSource) error {
-	var sqlDB *sql.DB
-	var tx *sql.Tx
+	flags := flag.NewFlagSet(masterimport.AppName, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
 
-	queryBuilder := NewQueryBuilder(dataSource)
-	insertQueries, err := queryBuilder.InsertQueries()
-	if err != nil {
+	setDatabaseFlags(flags, database)
+
+	setSourceFlags(flags, &options, &basedir, &tableStr)
+	flags.BoolVar(&options.DisableForeignKeyChecks, "disable-fk-checks", false, "disable foreign key checks for the session")
+	flags.StringVar(&options.ColumnOrder, "column-order", options.ColumnOrder, "column order (file or sorted)")
+	flags.StringVar(&primaryKeyStr, "primary-key", "", "columns to sort rows by")
+	flags.StringVar(&options.Mode, "mode", options.Mode, "import mode (truncate or upsert)")
+	flags.BoolVar(&options.Atomic, "atomic", options.Atomic, "load every table in a single transaction using DELETE instead of TRUNCATE")
+	flags.BoolVar(&options.Swap, "swap", options.Swap, "load each table into a shadow table and swap it with the live table")
+	flags.BoolVar(&options.KeepOld, "keep-old", options.KeepOld, "keep the previous table as <table>_old after a swap")
+	flags.StringVar(&timeZoneName, "time-zone", options.TimeZone.String(), "time zone ISO-8601 timestamps are converted to for DATETIME columns")
+	flags.BoolVar(&options.Validate, "validate", options.Validate, "check sources against the table columns before loading")
+	flags.BoolVar(&options.DeleteMissing, "delete-missing", options.DeleteMissing, "delete rows missing from the source in upsert mode")
+	flags.BoolVar(&dryRun, "dry-run", false, "print statements instead of executing them")
+	flags.StringVar(&dryRunFile, "dry-run-file", "", "write dry run statements to file instead of stdout")
+	flags.IntVar(&options.BatchSize, "batch-size", options.BatchSize, "rows per statement (0 packs rows up to max_allowed_packet)")
+	flags.IntVar(&options.InfileThreshold, "infile-threshold", options.InfileThreshold, "use LOAD DATA LOCAL INFILE for tables with at least this many rows (0 disables)")
+	flags.StringVar(&output, "output", "", "write an executable SQL script to file instead of executing")
+
+	if err := parseFlags(flags, args); err != nil {
 		return err
 	}
-
-	sqlDB, err = db.Open()
-	if err != nil {
+	if err := applyEnvironment(flags, database, &basedir, &tableStr); err != nil {
 		return err
 	}
-	defer sqlDB.Close()
-
-	tx, err = sqlDB.Begin()
-	if err != nil {
+	if err := resolveCredentials(database); err != nil {
 		return err
 	}
-	defer func() {
-		if err := recover(); err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	_, err = tx.Exec(queryBuilder.TruncateQuery())
-	if err != nil {
-		panic(err)
-	}
-
-	for i := 0; i < len(insertQueries); i++ {
-		_, err = tx.Exec(insertQueries[i])
-		if err != nil {
-			panic(err)
-		}
-	}
 
-	err = tx.Commit()
+	location, err := time.LoadLocation(timeZoneName)
 	if err != nil {
-		panic(err)
+		return usageErrorf("invalid time zone: %s", timeZoneName)
 	}
+	options.TimeZone = location
 
-	return nil
-}
-
-func (db *Database) Open() (*sql.DB, error) {
-	dsn, err := db.DataSourceName()
-	if err != nil {
-		return nil, err
-	}
-
-	return sql.Open(driverName, dsn)
-}
-
-func (db *Database) DataSourceName() (string, error) {
-	if len(db.dataSourceName) > 0 {
-		return db.dataSourceName, nil
+	if len(primaryKeyStr) > 0 {
+		options.SortKeys = strings.Split(primaryKeyStr, tableNameDelimiter)
 	}
+	setSources(&options, basedir, tableStr)
 
-	if db.ValidOptions() {
-		user, err := db.selectUser()
-		if err != nil {
-			return "", err
-		}
-
-		db.dataSourceName = fmt.Sprintf("%s:%s@%s/%s%s", user,
-			db.Password, db.address(), db.Name, db.dsnOptions())
-
-		return db.dataSourceName, nil
-	} else {
-		return "", errors.New("Invalid options. Can't create DSN.")
-	}
-}
-
-func (db *Database) ValidOptions() bool {
-	for _, item := range []string{db.Name} {
-		if len(item) < 1 {
-			return false
-		}
+	if err := options.Check(); err != nil {
+		return err
 	}
-
-	return true
-}
-
-func (db *Database) selectUser() (string, error) {
-	if len(db.User) > 0 {
-		return db.User, nil
+	if err := options.CheckDriver(database.Driver); err != nil {
+		return err
 	}
 
-	user, err := user.Current()
+	dataSources, err := masterimport.SelectDataSources(options)
 	if err != nil {
-		return "", err
-	}
-	return user.Username, nil
-}
-
-func (db *Database) address() string {
-	sockSize := len(db.Socket)
-	hostSize := len(db.Host)
-	portSize := len(db.Port)
-
-	if sockSize > 0 {
-		return fmt.Sprintf("unix(%s)", db.Socket)
+		return err
 	}
 
-	if (hostSize + portSize) > 0 {
-		if hostSize == 0 {
-			db.Host = defaultHost
+	if len(output) > 0 {
+		if !database.ValidOptions() {
+			return usageErrorf("-output requires -db to read the column types of the tables")
 		}
-
-		if portSize == 0 {
-			db.Port = defaultPort
+		if options.Swap {
+			return usageErrorf("-output can not be combined with -swap, whose DDL commits implicitly")
 		}
-
-		return fmt.Sprintf("tcp(%s:%s)", db.Host, db.Port)
-	}
-
-	db.Socket = defaultSocket
-	return fmt.Sprintf("unix(%s)", db.Socket)
-}
-
-func (db *Database) dsnOptions() string {
-	if len(db.Params) < 1 {
-		return ""
-	}
-
-	params := make([]string, 0, len(db.Params))
-	for key, value := range db.Params {
-		params = append(params, fmt.Sprintf("%s=%s", key, value))
-	}
-	return fmt.Sprintf("?%s", strings.Join(params, "&"))
-}
-
-func getBaseDir(path string) string {
-	if len(path) > 0 {
-		abs, err := filepath.Abs(path)
-		if err != nil {
-			panic(err)
+		if options.Mode == masterimport.ImportModeUpsert && options.DeleteMissing {
+			return usageErrorf("-output can not be combined with -delete-missing, since missing rows are only known at run time")
 		}
-
-		return abs
-	}
-
-	current, err := os.Getwd()
-	if err != nil {
-		panic(err)
-	}
-
-	return filepath.Join(current, defaultBaseDirName)
-}
-
-func targetDataSources(path string, tableNames []string) []*DataSource {
-	sources, err := ioutil.ReadDir(path)
-	if err != nil {
-		panic(err)
 	}
 
-	if len(sources) == 0 {
-		fmt.Printf("source directories not found: %s\n", path)
-		os.Exit(ExitCodeError)
-	}
+	ctx := context.Background()
+	var references map[string][]string
+	if (len(output) > 0 || dryRun) && database.ValidOptions() {
+		if err := database.DescribeSources(ctx, dataSources); err != nil {
+			return err
+		}
 
-	var dataSources []*DataSource
-	for _, source := range sources {
-		if source.IsDir() {
-			dataSource, err := NewDataSource(filepath.Join(path, source.Name()))
+		if !options.DisableForeignKeyChecks {
+			references, err = database.ForeignKeys(ctx)
 			if err != nil {
-				panic(err)
-			}
-
-			if len(tableNames) == 0 {
-				dataSources = append(dataSources, dataSource)
-				continue
+				return err
 			}
-
-			for _, name := range tableNames {
-				if dataSource.TableName == name {
-					dataSources = append(dataSources, dataSource)
-				}
+			dataSources, err = masterimport.SortDataSources(dataSources, references)
+			if err != nil {
+				return err
 			}
 		}
 	}
 
-	if len(tableNames) > 0 && len(dataSources) != len(tableNames) {
-		for _, name := range tableNames {
-			notFound := true
-			for _, dataSource := range dataSources {
-				if name == dataSource.TableName {
-					notFound = false
-				}
-			}
-
-			if notFound {
-				fmt.Printf("source directory not found: %s\n", filepath.Join(path, name))
-			}
+	if len(output) > 0 {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
 		}
-		os.Exit(ExitCodeError)
-	}
+		defer file.Close()
 
-	return dataSources
-}
-
-func LoadSources(database *Database, dataSources []*DataSource) {
-	for _, dataSource := range dataSources {
-		if err := database.LoadWithTransaction(dataSource); err != nil {
-			panic(err)
-		}
+		return database.WriteScript(file, dataSources)
 	}
-}
-
-func main() {
-	var basedir, tableStr string
-	database := NewDatabase()
-
-	flags := flag.NewFlagSet(AppName, flag.ContinueOnError)
-	flags.SetOutput(os.Stderr)
 
-	flags.StringVar(&database.Host, "host", "", "database hostname")
-	flags.StringVar(&database.Port, "port", "", "database port")
-	flags.StringVar(&database.Socket, "socket", "", "database socket")
-	flags.StringVar(&database.Name, "db", "", "database name")
-	flags.StringVar(&database.User, "user", "", "database user")
-	flags.StringVar(&database.Password, "password", "", "database password")
-
-	flags.StringVar(&basedir, "basedir", "", "base directory")
-	flags.StringVar(&tableStr, "tables", "", "target tables")
-
-	if err := flags.Parse(os.Args[1:]); err != nil {
-		panic(err)
-	}
+	if dryRun {
+		writer := os.Stdout
+		if len(dryRunFile) > 0 {
+			file, err := os.Create(dryRunFile)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			writer = file
+		}
 
-	baseDir := getBaseDir(basedir)
-	if _, err := os.Stat(baseDir); err != nil {
-		fmt.Printf("basedir not found: %s\n", baseDir)
-		os.Exit(ExitCodeError)
+		return database.DumpSources(writer, dataSources, references)
 	}
 
-	names := make([]string, 0, 0)
-	if len(tableStr) > 0 {
-		names = strings.Split(tableStr, tableNameDelimiter)
+	sqlDB, err := database.Open(ctx)
+	if err != nil {
+		return err
 	}
+	defer sqlDB.Close()
 
-	dataSources := targetDataSources(baseDir, names)
-	LoadSources(database, dataSources)
+	return masterimport.NewLoader(sqlDB, database.Driver, options).Load(ctx)
 }
@@ -0,0 +1,186 @@
+package masterimport
+
+import (
+	"fmt"
+	"strings"
+)
+
+type QueryBuilder struct {
+	dataSource *DataSource
+	dialect    Dialect
+}
+
+func NewQueryBuilder(dataSource *DataSource, dialect Dialect) QueryBuilder {
+	return QueryBuilder{
+		dataSource: dataSource,
+		dialect:    dialect,
+	}
+}
+
+func (builder *QueryBuilder) sqlColumns() (string, error) {
+	var sqlElement string
+
+	columnNames, err := builder.dataSource.ColumnNames()
+	if err != nil {
+		return sqlElement, err
+	}
+
+	if len(columnNames) > 0 {
+		sqlElement = builder.dialect.QuoteIdentifier(columnNames[0])
+		for i := 1; i < len(columnNames); i++ {
+			sqlElement += ", " + builder.dialect.QuoteIdentifier(columnNames[i])
+		}
+		return fmt.Sprintf("(%s)", sqlElement), nil
+	}
+
+	return sqlElement, validationErrorf("Column names can not acquired: %s", builder.dataSource.TableName)
+}
+
+func (builder QueryBuilder) table() string {
+	return builder.dialect.QuoteIdentifier(builder.dataSource.TableName)
+}
+
+func (builder QueryBuilder) TruncateQuery() string {
+	return builder.dialect.TruncateQuery(builder.dataSource.TableName)
+}
+
+func (builder QueryBuilder) DeleteAllQuery() string {
+	return fmt.Sprintf("DELETE FROM %s", builder.table())
+}
+
+func (builder QueryBuilder) InsertQueries() (map[int]Statement, error) {
+	return builder.insertQueries("")
+}
+
+// UpsertQueries returns insert statements that update every column except
+// keys when a row with the same keys exists.
+func (builder QueryBuilder) UpsertQueries(keys []string) (map[int]Statement, error) {
+	columnNames, err := builder.dataSource.ColumnNames()
+	if err != nil {
+		return make(map[int]Statement), err
+	}
+
+	columns := make([]string, len(columnNames))
+	for i := 0; i < len(columnNames); i++ {
+		columns[i] = columnNames[i]
+	}
+
+	return builder.insertQueries(builder.dialect.UpsertClause(builder.dataSource.TableName, columns, keys))
+}
+
+func (builder QueryBuilder) insertQueries(suffix string) (map[int]Statement, error) {
+	queries := make(map[int]Statement)
+	stringValues, err := builder.dataSource.StringValues()
+	if err != nil || len(stringValues) == 0 {
+		return queries, err
+	}
+
+	table := builder.table()
+	sqlColumns, err := builder.sqlColumns()
+	if err != nil {
+		return queries, err
+	}
+
+	baseSize := len(table) + len(sqlColumns) + len(suffix) + len("INSERT INTO  VALUES ")
+	ranges := builder.batchRanges(len(stringValues), baseSize, func(i int) (int, int) {
+		args := stringValues[i].Args()
+		return len(stringValues[i].Placeholders()) + 1 + builder.argsSize(args), len(args)
+	})
+	for i, r := range ranges {
+		f, l := r[0], r[1]
+
+		placeholders := make([]string, 0, l-f)
+		args := make([]interface{}, 0, (l-f)*len(stringValues[f].Values))
+		for _, stringValue := range stringValues[f:l] {
+			placeholders = append(placeholders, stringValue.Placeholders())
+			args = append(args, stringValue.Args()...)
+		}
+
+		queries[i] = Statement{
+			Query: builder.dialect.Rebind(fmt.Sprintf("INSERT INTO %s %s VALUES %s%s", table, sqlColumns, strings.Join(placeholders, ","), suffix)),
+			Args:  args,
+		}
+	}
+	return queries, err
+}
+
+// batchRanges splits n rows into [from, to) ranges of at most BatchSize
+// rows. When BatchSize is zero, rows are packed until the statement
+// reaches MaxQueryBytes bytes instead. rowSize returns the estimated bytes
+// and the number of placeholders of a row.
+func (builder QueryBuilder) batchRanges(n, baseSize int, rowSize func(i int) (int, int)) [][2]int {
+	ranges := make([][2]int, 0, 0)
+	maxPlaceholders := builder.dialect.MaxPlaceholders()
+	queryValueSize := builder.dataSource.options.BatchSize
+	queryByteSize := builder.dataSource.options.MaxQueryBytes
+	if queryByteSize == 0 {
+		queryByteSize = defaultQueryByteSize
+	}
+
+	from, size, placeholders := 0, baseSize, 0
+	for i := 0; i < n; i++ {
+		bytes, args := rowSize(i)
+		if i > from {
+			full := i-from >= queryValueSize
+			if queryValueSize == 0 {
+				full = size+bytes > queryByteSize
+			}
+			if full || placeholders+args > maxPlaceholders {
+				ranges = append(ranges, [2]int{from, i})
+				from, size, placeholders = i, baseSize, 0
+			}
+		}
+		size += bytes
+		placeholders += args
+	}
+	if n > from {
+		ranges = append(ranges, [2]int{from, n})
+	}
+
+	return ranges
+}
+
+func (builder QueryBuilder) argsSize(args []interface{}) int {
+	size := 0
+	for _, arg := range args {
+		size += len(builder.dialect.QuoteLiteral(arg))
+	}
+	return size
+}
+
+func (builder QueryBuilder) SelectKeysQuery(keys []string) string {
+	return fmt.Sprintf("SELECT %s FROM %s", quoteIdentifiers(builder.dialect, keys), builder.table())
+}
+
+// DeleteQueries returns statements deleting the rows identified by values,
+// each of which holds one value per key column.
+func (builder QueryBuilder) DeleteQueries(keys []string, values [][]interface{}) map[int]Statement {
+	queries := make(map[int]Statement)
+
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		conditions[i] = fmt.Sprintf("%s = ?", builder.dialect.QuoteIdentifier(key))
+	}
+	condition := fmt.Sprintf("(%s)", strings.Join(conditions, " AND "))
+
+	baseSize := len(builder.table()) + len("DELETE FROM  WHERE ")
+	ranges := builder.batchRanges(len(values), baseSize, func(i int) (int, int) {
+		return len(condition) + len(" OR ") + builder.argsSize(values[i]), len(values[i])
+	})
+	for i, r := range ranges {
+		f, l := r[0], r[1]
+
+		where := make([]string, 0, l-f)
+		args := make([]interface{}, 0, (l-f)*len(keys))
+		for _, value := range values[f:l] {
+			where = append(where, condition)
+			args = append(args, value...)
+		}
+
+		queries[i] = Statement{
+			Query: builder.dialect.Rebind(fmt.Sprintf("DELETE FROM %s WHERE %s", builder.table(), strings.Join(where, " OR "))),
+			Args:  args,
+		}
+	}
+	return queries
+}
@@ -0,0 +1,155 @@
+package masterimport
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var roundTripTexts = []string{
+	"it's",
+	`say "hi"`,
+	`C:\path\`,
+	"line\nbreak\r\ttab",
+	"\x1a",
+	"?$1",
+	"🍣 emoji",
+	"",
+}
+
+// writeSource writes content to name and returns the data source reading
+// it.
+func writeSource(t *testing.T, name, content string, options Options) *DataSource {
+	t.Helper()
+
+	dataSource, err := NewDataSource(writeFile(t, name, content), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dataSource
+}
+
+func openSQLite(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open(DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if _, err := sqlDB.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return sqlDB
+}
+
+func roundTripSource(t *testing.T, options Options) *DataSource {
+	t.Helper()
+
+	content := ""
+	for i, text := range roundTripTexts {
+		row, err := marshalJSONRow([]string{"id", "body"}, []interface{}{i + 1, text}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content += string(row)
+	}
+	return writeSource(t, "texts.ndjson", content, options)
+}
+
+func checkRoundTrip(t *testing.T, sqlDB *sql.DB) {
+	t.Helper()
+
+	rows, err := sqlDB.Query("SELECT body FROM texts ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	i := 0
+	for ; rows.Next(); i++ {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			t.Fatal(err)
+		}
+		if i < len(roundTripTexts) && body != roundTripTexts[i] {
+			t.Errorf("row %d = %q, want %q", i+1, body, roundTripTexts[i])
+		}
+	}
+	if i != len(roundTripTexts) {
+		t.Errorf("got %d rows, want %d", i, len(roundTripTexts))
+	}
+}
+
+func TestInsertQueriesRoundTrip(t *testing.T) {
+	options := DefaultOptions()
+	options.BatchSize = 2
+	sqlDB := openSQLite(t, "CREATE TABLE texts (id INTEGER PRIMARY KEY, body TEXT NOT NULL)")
+
+	queries, err := NewQueryBuilder(roundTripSource(t, options), SQLiteDialect{}).InsertQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (len(roundTripTexts) + 1) / 2; len(queries) != want {
+		t.Fatalf("got %d statements, want %d", len(queries), want)
+	}
+
+	for i := 0; i < len(queries); i++ {
+		if _, err := sqlDB.Exec(queries[i].Query, queries[i].Args...); err != nil {
+			t.Fatalf("statement %d: %s", i+1, err)
+		}
+	}
+	checkRoundTrip(t, sqlDB)
+}
+
+func TestInterpolatedInsertRoundTrip(t *testing.T) {
+	sqlDB := openSQLite(t, "CREATE TABLE texts (id INTEGER PRIMARY KEY, body TEXT NOT NULL)")
+
+	queries, err := NewQueryBuilder(roundTripSource(t, DefaultOptions()), SQLiteDialect{}).InsertQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(queries); i++ {
+		if _, err := sqlDB.Exec(queries[i].Interpolate(SQLiteDialect{})); err != nil {
+			t.Fatalf("statement %d: %s", i+1, err)
+		}
+	}
+	checkRoundTrip(t, sqlDB)
+}
+
+func TestBatchRanges(t *testing.T) {
+	tests := []struct {
+		name          string
+		batchSize     int
+		maxQueryBytes int
+		n             int
+		rowBytes      int
+		rowArgs       int
+		want          [][2]int
+	}{
+		{"no rows", 2, 0, 0, 30, 2, [][2]int{}},
+		{"batch size", 2, 0, 5, 30, 2, [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+		{"query bytes", 0, 100, 5, 30, 2, [][2]int{{0, 3}, {3, 5}}},
+		{"oversized rows", 0, 10, 2, 30, 2, [][2]int{{0, 1}, {1, 2}}},
+		{"placeholders", 100, 0, 5, 30, 16000, [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+	}
+
+	for _, test := range tests {
+		options := DefaultOptions()
+		options.BatchSize = test.batchSize
+		options.MaxQueryBytes = test.maxQueryBytes
+		builder := NewQueryBuilder(&DataSource{options: options}, SQLiteDialect{})
+
+		got := builder.batchRanges(test.n, 10, func(int) (int, int) {
+			return test.rowBytes, test.rowArgs
+		})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ranges = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
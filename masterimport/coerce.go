@@ -0,0 +1,150 @@
+package masterimport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+}
+
+// DescribeSources reads the columns and primary key of the target table of
+// every data source, so that values can be validated and coerced by column
+// type, and whether its sequence can be reset. It must be called before
+// the values of a data source are built.
+func (db *Database) DescribeSources(ctx context.Context, dataSources []*DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	for _, dataSource := range dataSources {
+		if err := db.describeSource(ctx, sqlDB, dialect, dataSource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) describeSource(ctx context.Context, sqlDB queryer, dialect Dialect, dataSource *DataSource) error {
+	columns, err := db.tableColumns(ctx, sqlDB, dialect, dataSource.TableName)
+	if err != nil {
+		return sqlError(dataSource.TableName, 0, err)
+	}
+
+	keys, err := db.primaryKeyColumns(ctx, sqlDB, dataSource.TableName)
+	if err != nil {
+		return sqlError(dataSource.TableName, 0, err)
+	}
+
+	if resetter, ok := dialect.(SequenceResetter); ok {
+		var count int
+		if err := sqlDB.QueryRowContext(ctx, resetter.SequenceTableQuery()).Scan(&count); err != nil {
+			return sqlError(dataSource.TableName, 0, err)
+		}
+		dataSource.sequenced = count > 0
+	}
+
+	dataSource.columns = columns
+	dataSource.tableKeys = keys
+	return nil
+}
+
+// column returns the described column of the target table named name.
+func (ds *DataSource) column(name string) (Column, bool) {
+	for _, column := range ds.columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// coerceValue converts a source value to the representation expected by
+// column: booleans become 1 or 0 in integer columns, any value is encoded
+// as JSON text in JSON columns, ISO-8601 strings are converted to timeZone
+// in date and datetime columns and strings are base64 decoded in binary
+// columns. Timestamp columns are left alone: the server reads a timestamp
+// in the session time zone, so converting it to timeZone would shift the
+// instant, while an offset given with the value is honored. When text is set, the value was read from a CSV or TSV cell and
+// a string holding a JSON document is kept as is in JSON columns.
+func coerceValue(column Column, value interface{}, text bool, timeZone *time.Location) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch column.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "bit":
+		if b, ok := value.(bool); ok {
+			if b {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case "json", "jsonb":
+		if s, ok := value.(string); ok && text && json.Valid([]byte(s)) {
+			return s, nil
+		}
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(bytes), nil
+	case "datetime", "timestamp without time zone", "date":
+		text, ok := value.(string)
+		if !ok {
+			break
+		}
+		t, ok := parseTime(text, timeZone)
+		if !ok {
+			break
+		}
+		if column.DataType == "date" {
+			return t.In(timeZone).Format(dateFormat), nil
+		}
+		return t.In(timeZone).Format(datetimeFormat), nil
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob", "bytea":
+		text, ok := value.(string)
+		if !ok {
+			break
+		}
+		bytes, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("value is not base64 encoded")
+		}
+		return bytes, nil
+	}
+
+	return value, nil
+}
+
+// parseTime parses an ISO-8601 timestamp. Timestamps without an offset are
+// taken to be in timeZone already.
+func parseTime(text string, timeZone *time.Location) (time.Time, bool) {
+	if !strings.Contains(text, "T") {
+		return time.Time{}, false
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, text, timeZone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
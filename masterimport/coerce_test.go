@@ -0,0 +1,48 @@
+package masterimport
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoerceValue(t *testing.T) {
+	jsonColumn := Column{Name: "doc", DataType: "json"}
+	intColumn := Column{Name: "flag", DataType: "tinyint"}
+	blobColumn := Column{Name: "data", DataType: "blob"}
+	datetimeColumn := Column{Name: "at", DataType: "datetime"}
+	timestampColumn := Column{Name: "at", DataType: "timestamp"}
+
+	tests := []struct {
+		column Column
+		value  interface{}
+		text   bool
+		want   interface{}
+	}{
+		{jsonColumn, `{"a": 1}`, true, `{"a": 1}`},
+		{jsonColumn, `not json`, true, `"not json"`},
+		{jsonColumn, `{"a": 1}`, false, `"{\"a\": 1}"`},
+		{jsonColumn, map[string]interface{}{"a": []interface{}{"b"}}, false, `{"a":["b"]}`},
+		{jsonColumn, nil, true, nil},
+		{intColumn, true, false, 1},
+		{intColumn, "1", true, "1"},
+		{blobColumn, "AP8=", false, []byte{0x00, 0xff}},
+		{datetimeColumn, "2020-01-02T09:00:00+09:00", false, "2020-01-02 00:00:00"},
+		{timestampColumn, "2020-01-02T09:00:00+09:00", false, "2020-01-02T09:00:00+09:00"},
+	}
+
+	for _, test := range tests {
+		got, err := coerceValue(test.column, test.value, test.text, time.UTC)
+		if err != nil {
+			t.Errorf("coerceValue(%s, %#v): %s", test.column.DataType, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("coerceValue(%s, %#v, %t) = %#v, want %#v", test.column.DataType, test.value, test.text, got, test.want)
+		}
+	}
+
+	if _, err := coerceValue(blobColumn, "not base64!", false, time.UTC); err == nil {
+		t.Error("expected an error for a value that is not base64 encoded")
+	}
+}
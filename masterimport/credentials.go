@@ -0,0 +1,148 @@
+package masterimport
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	OptionFileName  = ".my.cnf"
+	optionFileGroup = "client"
+)
+
+// Environment variables read by the mysql client.
+const (
+	envPassword = "MYSQL_PWD"
+	envHost     = "MYSQL_HOST"
+	envPort     = "MYSQL_TCP_PORT"
+	envSocket   = "MYSQL_UNIX_PORT"
+	envUser     = "MYSQL_USER"
+)
+
+var optionReplacer = strings.NewReplacer(
+	`\\`, `\`,
+	`\n`, "\n",
+	`\t`, "\t",
+	`\r`, "\r",
+	`\b`, "\b",
+	`\s`, " ",
+)
+
+// ResolveCredentials fills user, password, host, port and socket of a
+// MySQL database that were not given explicitly, first from the [client]
+// group of the option file and then from the MYSQL_* environment
+// variables, the precedence of the mysql client. The option file is
+// DefaultsFile when set, ~/.my.cnf otherwise. Host, port and socket are
+// taken together from the first source that sets any of them.
+func (db *Database) ResolveCredentials() error {
+	if db.Driver != DriverMySQL {
+		return nil
+	}
+
+	options, err := db.readOptionFile()
+	if err != nil {
+		return err
+	}
+	db.applyOptions(options)
+
+	db.applyOptions(map[string]string{
+		"user":     os.Getenv(envUser),
+		"password": os.Getenv(envPassword),
+		"host":     os.Getenv(envHost),
+		"port":     os.Getenv(envPort),
+		"socket":   os.Getenv(envSocket),
+	})
+
+	return nil
+}
+
+func (db *Database) applyOptions(options map[string]string) {
+	if len(db.User) == 0 {
+		db.User = options["user"]
+	}
+	if len(db.Password) == 0 {
+		db.Password = options["password"]
+	}
+	if len(db.Host)+len(db.Port)+len(db.Socket) == 0 {
+		db.Host = options["host"]
+		db.Port = options["port"]
+		db.Socket = options["socket"]
+	}
+}
+
+// readOptionFile returns the options of the [client] group. A missing
+// ~/.my.cnf is not an error, but a missing DefaultsFile is.
+func (db *Database) readOptionFile() (map[string]string, error) {
+	path := db.DefaultsFile
+	if len(path) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+
+		path = filepath.Join(home, OptionFileName)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseOptionFile(file.Name(), bufio.NewScanner(file), optionFileGroup)
+}
+
+// parseOptionFile reads the options of group from a file in the format of
+// MySQL option files. Dashes in option names are read as underscores, as
+// the mysql client does.
+func parseOptionFile(name string, scanner *bufio.Scanner, group string) (map[string]string, error) {
+	options := make(map[string]string)
+	current := ""
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' || text[0] == ';' || text[0] == '!' {
+			continue
+		}
+
+		if text[0] == '[' {
+			if !strings.HasSuffix(text, "]") {
+				return nil, &ParseError{File: name, Line: line, Err: errors.New("invalid group")}
+			}
+			current = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+
+		if current != group {
+			continue
+		}
+
+		key, value := text, ""
+		if i := strings.Index(text, "="); i >= 0 {
+			key, value = strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		}
+		options[strings.Replace(key, "-", "_", -1)] = optionValue(value)
+	}
+
+	return options, scanner.Err()
+}
+
+// optionValue unquotes an option value or strips a trailing comment from
+// an unquoted one.
+func optionValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.LastIndexByte(value, value[0]); end > 0 {
+			return optionReplacer.Replace(value[1:end])
+		}
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return optionReplacer.Replace(value)
+}
@@ -0,0 +1,95 @@
+package masterimport
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOptionFile(t *testing.T) {
+	content := strings.Join([]string{
+		"# comment",
+		"[mysqld]",
+		"user = server",
+		"",
+		"[client]",
+		"; comment",
+		"user = app",
+		`password = "p#ss word"`,
+		"host=db.example.com # primary",
+		"default-character-set = utf8mb4",
+		`socket = '/var/run/my\\sql.sock'`,
+		"skip-ssl",
+		"!include /etc/mysql/extra.cnf",
+		"[mysql]",
+		"user = other",
+	}, "\n")
+
+	got, err := parseOptionFile("my.cnf", bufio.NewScanner(strings.NewReader(content)), optionFileGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"user":                  "app",
+		"password":              "p#ss word",
+		"host":                  "db.example.com",
+		"default_character_set": "utf8mb4",
+		"socket":                `/var/run/my\sql.sock`,
+		"skip_ssl":              "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("options = %q, want %q", got, want)
+	}
+}
+
+func TestParseOptionFileInvalidGroup(t *testing.T) {
+	content := "[client]\nuser = app\n[client\n"
+
+	_, err := parseOptionFile("my.cnf", bufio.NewScanner(strings.NewReader(content)), optionFileGroup)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 3 {
+		t.Errorf("error = %v, want a ParseError at line 3", err)
+	}
+}
+
+func TestReadOptionFileHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := ioutil.WriteFile(filepath.Join(home, OptionFileName), []byte("[client]\nuser = home_user\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&Database{}).readOptionFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["user"] != "home_user" {
+		t.Errorf("options = %q, want the user of $HOME/%s", got, OptionFileName)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv(envUser, "env_user")
+	t.Setenv(envPassword, "env_password")
+	t.Setenv(envHost, "env.example.com")
+	t.Setenv(envPort, "")
+	t.Setenv(envSocket, "")
+
+	db := NewDatabase()
+	db.Host = "flag.example.com"
+	db.DefaultsFile = writeFile(t, "my.cnf", "[client]\nuser = file_user\nhost = file.example.com\n")
+	if err := db.ResolveCredentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{db.User, db.Password, db.Host}
+	want := []string{"file_user", "env_password", "flag.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("user, password and host = %q, want %q", got, want)
+	}
+}
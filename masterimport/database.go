@@ -0,0 +1,678 @@
+package masterimport
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+type Database struct {
+	Driver                  string
+	Host                    string
+	Port                    string
+	Socket                  string
+	Name                    string
+	User                    string
+	Password                string
+	DefaultsFile            string
+	SSLMode                 string
+	SSLCA                   string
+	SSLCert                 string
+	SSLKey                  string
+	Params                  map[string]string
+	DisableForeignKeyChecks bool
+	dataSourceName          string
+	pool                    *sql.DB
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		Driver: defaultDriver,
+	}
+}
+
+func (db *Database) Dialect() (Dialect, error) {
+	return LookupDialect(db.Driver)
+}
+
+func (db *Database) LoadWithTransaction(ctx context.Context, dataSource *DataSource) error {
+	if dataSource.options.Mode == ImportModeUpsert {
+		return db.syncWithTransaction(ctx, dataSource)
+	}
+
+	return db.loadWithTransaction(ctx, dataSource)
+}
+
+func (db *Database) loadWithTransaction(ctx context.Context, dataSource *DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	queryBuilder := NewQueryBuilder(dataSource, dialect)
+	if _, err := dataSource.StringValues(); err != nil {
+		return err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	tx, end, err := db.begin(ctx, sqlDB, dialect)
+	if err != nil {
+		return sqlError(dataSource.TableName, 0, err)
+	}
+	defer end()
+
+	if _, err := tx.ExecContext(ctx, queryBuilder.TruncateQuery()); err != nil {
+		tx.Rollback()
+		return sqlError(dataSource.TableName, 0, err)
+	}
+
+	if err := db.resetSequence(ctx, tx, dialect, dataSource.TableName); err != nil {
+		tx.Rollback()
+		return sqlError(dataSource.TableName, 0, err)
+	}
+
+	if err := db.insertRows(ctx, tx, queryBuilder); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return sqlError(dataSource.TableName, 0, tx.Commit())
+}
+
+// insertRows inserts the rows of the builder's data source, through
+// LOAD DATA when the table qualifies for it.
+func (db *Database) insertRows(ctx context.Context, tx *sql.Tx, queryBuilder QueryBuilder) error {
+	insertQueries, err := queryBuilder.InsertQueries()
+	if err != nil {
+		return err
+	}
+
+	useInfile, err := canLoadInfile(queryBuilder.dialect, queryBuilder.dataSource)
+	if err != nil {
+		return err
+	}
+
+	if useInfile {
+		loaded, err := db.loadInfile(ctx, tx, queryBuilder)
+		if err != nil || loaded {
+			return sqlError(queryBuilder.dataSource.TableName, 0, err)
+		}
+	}
+
+	for i := 0; i < len(insertQueries); i++ {
+		_, err = tx.ExecContext(ctx, insertQueries[i].Query, insertQueries[i].Args...)
+		if err != nil {
+			return sqlError(queryBuilder.dataSource.TableName, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadAtomically loads every data source in a single transaction. Tables
+// are emptied with DELETE in reverse order, since TRUNCATE commits
+// implicitly on some servers, and any error rolls back every table.
+func (db *Database) LoadAtomically(ctx context.Context, dataSources []*DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	for _, dataSource := range dataSources {
+		if _, err := dataSource.StringValues(); err != nil {
+			return err
+		}
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	tx, end, err := db.begin(ctx, sqlDB, dialect)
+	if err != nil {
+		return &SQLError{Table: dataSources[0].TableName, Err: err}
+	}
+	defer end()
+
+	for i := len(dataSources) - 1; i >= 0; i-- {
+		if dataSources[i].options.Mode == ImportModeTruncate {
+			queryBuilder := NewQueryBuilder(dataSources[i], dialect)
+			if _, err := tx.ExecContext(ctx, queryBuilder.DeleteAllQuery()); err != nil {
+				tx.Rollback()
+				return sqlError(dataSources[i].TableName, 0, err)
+			}
+		}
+	}
+
+	for _, dataSource := range dataSources {
+		queryBuilder := NewQueryBuilder(dataSource, dialect)
+		if dataSource.options.Mode == ImportModeUpsert {
+			err = db.syncRows(ctx, tx, queryBuilder)
+		} else {
+			err = db.insertRows(ctx, tx, queryBuilder)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return sqlError(dataSources[len(dataSources)-1].TableName, 0, tx.Commit())
+}
+
+// begin starts a transaction on a dedicated connection of sqlDB,
+// disabling foreign key checks for its session when
+// DisableForeignKeyChecks is set. The returned function must be called
+// once the transaction has ended. It enables the checks again before the
+// connection goes back to the pool, and discards the connection when that
+// fails.
+func (db *Database) begin(ctx context.Context, sqlDB *sql.DB, dialect Dialect) (*sql.Tx, func(), error) {
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end := func() {
+		conn.Close()
+	}
+	if db.DisableForeignKeyChecks {
+		if _, err := conn.ExecContext(ctx, dialect.ForeignKeyChecksQuery(false)); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		end = func() {
+			if _, err := conn.ExecContext(context.Background(), dialect.ForeignKeyChecksQuery(true)); err != nil {
+				conn.Raw(func(interface{}) error {
+					return driver.ErrBadConn
+				})
+			}
+			conn.Close()
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		end()
+		return nil, nil, err
+	}
+
+	return tx, end, nil
+}
+
+// syncWithTransaction upserts source rows by the primary key of the table
+// and deletes rows missing from the source when DeleteMissing is set.
+// Rows that are unchanged are left alone.
+func (db *Database) syncWithTransaction(ctx context.Context, dataSource *DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	if _, err := dataSource.StringValues(); err != nil {
+		return err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	tx, end, err := db.begin(ctx, sqlDB, dialect)
+	if err != nil {
+		return sqlError(dataSource.TableName, 0, err)
+	}
+	defer end()
+
+	if err := db.syncRows(ctx, tx, NewQueryBuilder(dataSource, dialect)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return sqlError(dataSource.TableName, 0, tx.Commit())
+}
+
+func (db *Database) syncRows(ctx context.Context, tx *sql.Tx, queryBuilder QueryBuilder) error {
+	dataSource := queryBuilder.dataSource
+
+	keys, err := db.primaryKeyColumns(ctx, tx, dataSource.TableName)
+	if err != nil {
+		return sqlError(dataSource.TableName, 0, err)
+	}
+	if len(keys) == 0 {
+		return validationErrorf("Primary key not found: %s", dataSource.TableName)
+	}
+
+	sourceKeys, err := dataSource.KeyValues(keys)
+	if err != nil {
+		return err
+	}
+
+	upsertQueries, err := queryBuilder.UpsertQueries(keys)
+	if err != nil {
+		return err
+	}
+
+	statements := make([]Statement, 0, len(upsertQueries))
+	if dataSource.options.DeleteMissing {
+		missingKeys, err := db.missingKeys(ctx, tx, queryBuilder, keys, sourceKeys)
+		if err != nil {
+			return sqlError(dataSource.TableName, 0, err)
+		}
+
+		deleteQueries := queryBuilder.DeleteQueries(keys, missingKeys)
+		for i := 0; i < len(deleteQueries); i++ {
+			statements = append(statements, deleteQueries[i])
+		}
+	}
+	for i := 0; i < len(upsertQueries); i++ {
+		statements = append(statements, upsertQueries[i])
+	}
+
+	for i, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.Query, statement.Args...); err != nil {
+			return sqlError(dataSource.TableName, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// MaxQuerySize returns the largest statement the server accepts in bytes,
+// or defaultQueryByteSize when the dialect has no such limit.
+func (db *Database) MaxQuerySize(ctx context.Context) (int, error) {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return 0, err
+	}
+
+	query := dialect.MaxPacketQuery()
+	if len(query) == 0 {
+		return defaultQueryByteSize, nil
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer db.release(sqlDB)
+
+	var size int
+	if err := sqlDB.QueryRowContext(ctx, query).Scan(&size); err != nil {
+		return 0, sqlError("", 0, err)
+	}
+	return size, nil
+}
+
+// resetSequence resets the auto increment sequence of table for dialects
+// whose truncation leaves it untouched.
+func (db *Database) resetSequence(ctx context.Context, tx *sql.Tx, dialect Dialect, table string) error {
+	resetter, ok := dialect.(SequenceResetter)
+	if !ok {
+		return nil
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, resetter.SequenceTableQuery()).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	query := resetter.ResetSequenceQuery(table)
+	_, err := tx.ExecContext(ctx, query.Query, query.Args...)
+	return err
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (db *Database) primaryKeyColumns(ctx context.Context, sqlDB queryer, table string) ([]string, error) {
+	keys := make([]string, 0, 0)
+
+	dialect, err := db.Dialect()
+	if err != nil {
+		return keys, err
+	}
+
+	query := dialect.PrimaryKeyQuery(table)
+	rows, err := sqlDB.QueryContext(ctx, query.Query, query.Args...)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// missingKeys returns the keys of rows in the table that are absent from
+// sourceKeys.
+func (db *Database) missingKeys(ctx context.Context, tx *sql.Tx, queryBuilder QueryBuilder, keys []string, sourceKeys [][]interface{}) ([][]interface{}, error) {
+	missing := make([][]interface{}, 0, 0)
+
+	present := make(map[string]bool)
+	for _, sourceKey := range sourceKeys {
+		present[keyString(sourceKey)] = true
+	}
+
+	rows, err := tx.QueryContext(ctx, queryBuilder.SelectKeysQuery(keys))
+	if err != nil {
+		return missing, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]interface{}, len(keys))
+		dest := make([]interface{}, len(keys))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return missing, err
+		}
+
+		if !present[keyString(values)] {
+			missing = append(missing, values)
+		}
+	}
+
+	return missing, rows.Err()
+}
+
+// Open returns the connection pool given to NewLoader, or opens and pings
+// a new one from the connection settings.
+func (db *Database) Open(ctx context.Context) (*sql.DB, error) {
+	if db.pool != nil {
+		return db.pool, nil
+	}
+
+	dialect, err := db.Dialect()
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := db.DataSourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := sql.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, &ConnectionError{Err: err}
+	}
+	return sqlDB, nil
+}
+
+// release closes sqlDB unless it is the pool given to NewLoader, which is
+// owned by the caller.
+func (db *Database) release(sqlDB *sql.DB) {
+	if sqlDB != db.pool {
+		sqlDB.Close()
+	}
+}
+
+func (db *Database) DataSourceName() (string, error) {
+	if len(db.dataSourceName) > 0 {
+		return db.dataSourceName, nil
+	}
+
+	if db.ValidOptions() {
+		dialect, err := db.Dialect()
+		if err != nil {
+			return "", err
+		}
+
+		user, err := db.selectUser()
+		if err != nil {
+			return "", err
+		}
+
+		if err := db.configureTLS(dialect); err != nil {
+			return "", err
+		}
+
+		db.dataSourceName = dialect.DataSourceName(db, user)
+
+		return db.dataSourceName, nil
+	} else {
+		return "", usageErrorf("Invalid options. Can't create DSN.")
+	}
+}
+
+func (db *Database) ValidOptions() bool {
+	for _, item := range []string{db.Name} {
+		if len(item) < 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (db *Database) selectUser() (string, error) {
+	if len(db.User) > 0 {
+		return db.User, nil
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+func (db *Database) address() string {
+	sockSize := len(db.Socket)
+	hostSize := len(db.Host)
+	portSize := len(db.Port)
+
+	if sockSize > 0 {
+		return fmt.Sprintf("unix(%s)", db.Socket)
+	}
+
+	if (hostSize + portSize) > 0 {
+		if hostSize == 0 {
+			db.Host = defaultHost
+		}
+
+		if portSize == 0 {
+			db.Port = defaultPort
+		}
+
+		return fmt.Sprintf("tcp(%s:%s)", db.Host, db.Port)
+	}
+
+	db.Socket = defaultSocket
+	return fmt.Sprintf("unix(%s)", db.Socket)
+}
+
+// dsnOptions renders Params as a query string in key order. Values are
+// escaped since drivers unescape them.
+func (db *Database) dsnOptions() string {
+	if len(db.Params) < 1 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(db.Params))
+	for key := range db.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		params[i] = fmt.Sprintf("%s=%s", key, url.QueryEscape(db.Params[key]))
+	}
+	return fmt.Sprintf("?%s", strings.Join(params, "&"))
+}
+
+// DumpSources writes the statements a Loader would execute to writer
+// without connecting to the database. Values of data sources that were not
+// described with DescribeSources are written as read from the sources.
+// references, as returned by ForeignKeys, or nil when foreign keys are not
+// checked, select the same loading as Loader: in truncate mode, tables
+// referencing each other are emptied with DELETE instead of TRUNCATE.
+func (db *Database) DumpSources(writer io.Writer, dataSources []*DataSource, references map[string][]string) error {
+	return db.dumpSources(writer, dataSources, hasReferences(dataSources, references))
+}
+
+// dumpSources writes the statements of dataSources. In atomic mode, and
+// whenever deleteAll is set, tables are emptied with DELETE in reverse
+// order before any rows are inserted, since TRUNCATE commits implicitly on
+// some servers.
+func (db *Database) dumpSources(writer io.Writer, dataSources []*DataSource, deleteAll bool) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	for i := len(dataSources) - 1; i >= 0; i-- {
+		options := dataSources[i].options
+		if options.Mode != ImportModeTruncate || options.Swap || !(options.Atomic || deleteAll) {
+			continue
+		}
+
+		queryBuilder := NewQueryBuilder(dataSources[i], dialect)
+		if _, err := fmt.Fprintf(writer, "-- %s\n%s;\n", dataSources[i].TableName, queryBuilder.DeleteAllQuery()); err != nil {
+			return err
+		}
+	}
+
+	for _, dataSource := range dataSources {
+		queryBuilder := NewQueryBuilder(dataSource, dialect)
+
+		statements := make([]Statement, 0, 0)
+		options := dataSource.options
+		if options.Mode == ImportModeUpsert {
+			if len(options.SortKeys) == 0 {
+				return usageErrorf("SortKeys (-primary-key) are required to dump upsert statements: %s", dataSource.TableName)
+			}
+
+			upsertQueries, err := queryBuilder.UpsertQueries(options.SortKeys)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < len(upsertQueries); i++ {
+				statements = append(statements, upsertQueries[i])
+			}
+		} else if options.Swap {
+			statements, err = db.swapStatements(dialect, dataSource)
+			if err != nil {
+				return err
+			}
+		} else {
+			insertQueries, err := queryBuilder.InsertQueries()
+			if err != nil {
+				return err
+			}
+			if !options.Atomic && !deleteAll {
+				statements = append(statements, Statement{Query: queryBuilder.TruncateQuery()})
+				if resetter, ok := dialect.(SequenceResetter); ok && dataSource.sequenced {
+					statements = append(statements, resetter.ResetSequenceQuery(dataSource.TableName))
+				}
+			}
+			for i := 0; i < len(insertQueries); i++ {
+				statements = append(statements, insertQueries[i])
+			}
+		}
+
+		if _, err := fmt.Fprintf(writer, "-- %s\n", dataSource.TableName); err != nil {
+			return err
+		}
+		if dataSource.columns == nil {
+			if _, err := fmt.Fprintf(writer, "-- column types unknown: values are not coerced\n"); err != nil {
+				return err
+			}
+		}
+		if options.Mode == ImportModeUpsert && options.DeleteMissing {
+			if _, err := fmt.Fprintf(writer, "-- rows missing from the source are deleted at run time\n"); err != nil {
+				return err
+			}
+		}
+		for _, statement := range statements {
+			if _, err := fmt.Fprintf(writer, "%s;\n", statement.Interpolate(dialect)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteScript writes an executable script that loads dataSources in a
+// single transaction, emptying tables with DELETE as in atomic mode. Every
+// data source must have been described with DescribeSources, so that
+// values are coerced as they are on load. Swap and DeleteMissing are
+// refused: the DDL of a swap commits implicitly, and missing rows are only
+// known at run time.
+func (db *Database) WriteScript(writer io.Writer, dataSources []*DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	for _, dataSource := range dataSources {
+		options := dataSource.options
+		if options.Swap {
+			return usageErrorf("Swap (-swap) can not be written to a script, since its DDL commits implicitly")
+		}
+		if options.Mode == ImportModeUpsert && options.DeleteMissing {
+			return usageErrorf("DeleteMissing (-delete-missing) can not be written to a script, since missing rows are only known at run time")
+		}
+		if dataSource.columns == nil {
+			return usageErrorf("Column types of %s are unknown; call DescribeSources before WriteScript", dataSource.TableName)
+		}
+	}
+
+	if _, err := fmt.Fprintf(writer, "-- Generated by %s\n", AppName); err != nil {
+		return err
+	}
+	for _, statement := range dialect.ScriptHeader() {
+		if _, err := fmt.Fprintf(writer, "%s;\n", statement); err != nil {
+			return err
+		}
+	}
+
+	if err := db.dumpSources(writer, dataSources, true); err != nil {
+		return err
+	}
+
+	for _, statement := range dialect.ScriptFooter() {
+		if _, err := fmt.Fprintf(writer, "%s;\n", statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
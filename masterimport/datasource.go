@@ -0,0 +1,525 @@
+package masterimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	AppName            = "master-import"
+	defaultBaseDirName = "master"
+	tableNameDelimiter = ","
+	extDelimiter       = "."
+)
+
+const (
+	jsonExt   = ".json"
+	ndjsonExt = ".ndjson"
+	jsonlExt  = ".jsonl"
+	ymlExt    = ".yml"
+	yamlExt   = ".yaml"
+	csvExt    = ".csv"
+	tsvExt    = ".tsv"
+)
+
+var (
+	sourceExts = []string{jsonExt, ndjsonExt, jsonlExt, ymlExt, yamlExt}
+	tableExts  = []string{ndjsonExt, jsonlExt, csvExt, tsvExt}
+)
+
+const (
+	defaultDriver = DriverMySQL
+	defaultHost   = "localhost"
+	defaultPort   = "3306"
+	defaultSocket = "/tmp/mysql.sock"
+)
+
+const (
+	defaultQueryByteSize = 4 * 1024 * 1024
+	queryByteMargin      = 1024
+)
+
+const (
+	ColumnModeStrict = "strict"
+	ColumnModeUnion  = "union"
+)
+
+const (
+	ColumnOrderFile   = "file"
+	ColumnOrderSorted = "sorted"
+)
+
+const (
+	ImportModeTruncate = "truncate"
+	ImportModeUpsert   = "upsert"
+)
+
+// DefaultValue marks a column that is absent from a row and is filled with
+// the column default of the table.
+type DefaultValue struct{}
+
+type StringValue struct {
+	Values map[int]interface{}
+}
+
+func NewStringValue() StringValue {
+	return StringValue{
+		Values: make(map[int]interface{}),
+	}
+}
+
+// SetValue stores arg for the column at index. Objects and arrays are
+// stored as JSON text.
+func (sv StringValue) SetValue(index int, arg interface{}) error {
+	switch arg.(type) {
+	case string, int, int64, uint64, float64, json.Number, bool, []byte, nil, DefaultValue:
+		sv.Values[index] = arg
+	case []interface{}, map[string]interface{}:
+		bytes, err := json.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		sv.Values[index] = string(bytes)
+	default:
+		return fmt.Errorf("Unexpected value: %v", arg)
+	}
+
+	return nil
+}
+
+func (sv StringValue) Args() []interface{} {
+	args := make([]interface{}, 0, len(sv.Values))
+	for i := 0; i < len(sv.Values); i++ {
+		if _, ok := sv.Values[i].(DefaultValue); ok {
+			continue
+		}
+		args = append(args, sv.Values[i])
+	}
+	return args
+}
+
+func (sv StringValue) Placeholders() string {
+	placeholders := make([]string, len(sv.Values))
+	for i := 0; i < len(sv.Values); i++ {
+		if _, ok := sv.Values[i].(DefaultValue); ok {
+			placeholders[i] = "DEFAULT"
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+	return fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))
+}
+
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+type DataSource struct {
+	Source       string
+	TableName    string
+	sourceFiles  []string
+	header       []string
+	rows         []sourceRow
+	columnNames  map[int]string
+	stringValues []StringValue
+	columns      []Column
+	tableKeys    []string
+	sequenced    bool
+	options      Options
+}
+
+type sourceRow struct {
+	Location string
+	Names    []string
+	Data     map[string]interface{}
+	// Text is set for rows of CSV and TSV files, whose values are all
+	// strings.
+	Text bool
+}
+
+func NewDataSource(source string, options Options) (*DataSource, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+
+	baseName := filepath.Base(abs)
+	elements := strings.Split(baseName, extDelimiter)
+	tableName := elements[0]
+
+	return &DataSource{
+		Source:      abs,
+		TableName:   tableName,
+		columnNames: make(map[int]string),
+		options:     options,
+	}, nil
+}
+
+func (ds *DataSource) SourceFiles() ([]string, error) {
+	if len(ds.sourceFiles) == 0 {
+		src, err := os.Stat(ds.Source)
+		if err != nil {
+			return []string{}, &SourceNotFoundError{Path: ds.Source}
+		}
+
+		if src.IsDir() {
+			matches := make([]string, 0, 0)
+			for _, ext := range sourceExts {
+				pattern := filepath.Join(ds.Source, "*"+ext)
+				files, err := filepath.Glob(pattern)
+				if err != nil {
+					return matches, err
+				}
+				matches = append(matches, files...)
+			}
+			sort.Strings(matches)
+			ds.sourceFiles = matches
+			return matches, nil
+		}
+
+		ds.sourceFiles = []string{ds.Source}
+	}
+
+	return ds.sourceFiles, nil
+}
+
+// sourceRows returns the rows of every source file. Rows are ordered by
+// file name and then by their position in the file, or by the values of
+// SortKeys when they are given.
+func (ds *DataSource) sourceRows() ([]sourceRow, error) {
+	if len(ds.rows) == 0 {
+		sources, err := ds.SourceFiles()
+		if err != nil {
+			return ds.rows, err
+		}
+
+		for _, source := range sources {
+			header, rows, err := readRows(source, ds.options.CSVEmptyAsNull)
+			if err != nil {
+				return ds.rows, err
+			}
+			ds.header = header
+
+			for i, row := range rows {
+				row.Location = source
+				if len(rows) > 1 || isTableFile(source) {
+					row.Location = fmt.Sprintf("%s: row %d", source, i+1)
+				}
+				ds.rows = append(ds.rows, row)
+			}
+		}
+
+		if len(ds.options.SortKeys) > 0 {
+			sort.SliceStable(ds.rows, func(i, j int) bool {
+				for _, name := range ds.options.SortKeys {
+					if c := compareValues(ds.rows[i].Data[name], ds.rows[j].Data[name]); c != 0 {
+						return c < 0
+					}
+				}
+				return false
+			})
+		}
+	}
+
+	return ds.rows, nil
+}
+
+// compareValues orders NULL first, then numbers numerically and everything
+// else by its string representation.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	af, aErr := strconv.ParseFloat(fmt.Sprint(a), 64)
+	bf, bErr := strconv.ParseFloat(fmt.Sprint(b), 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// ColumnNames returns the header of a CSV or TSV source, or the union of
+// the keys of every row. Columns keep the key order of the first row
+// followed by keys first seen in later rows, or are sorted by name when
+// ColumnOrder is ColumnOrderSorted. In strict mode rows that lack any of
+// the columns are reported as an error.
+func (ds *DataSource) ColumnNames() (map[int]string, error) {
+	if len(ds.columnNames) == 0 {
+		rows, err := ds.sourceRows()
+		if err != nil {
+			return ds.columnNames, err
+		}
+
+		names := make([]string, 0, 0)
+		seen := make(map[string]bool)
+		for _, name := range ds.header {
+			seen[name] = true
+			names = append(names, name)
+		}
+		for _, row := range rows {
+			for _, name := range row.Names {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+
+		if ds.options.ColumnOrder == ColumnOrderSorted {
+			sort.Strings(names)
+		}
+		for i, name := range names {
+			ds.columnNames[i] = name
+		}
+
+		if ds.options.ColumnMode == ColumnModeStrict {
+			if err := ds.checkColumns(rows); err != nil {
+				ds.columnNames = make(map[int]string)
+				return ds.columnNames, err
+			}
+		}
+	}
+
+	return ds.columnNames, nil
+}
+
+func (ds *DataSource) checkColumns(rows []sourceRow) error {
+	problems := make([]string, 0, 0)
+	for _, row := range rows {
+		missing := make([]string, 0, 0)
+		for i := 0; i < len(ds.columnNames); i++ {
+			if _, ok := row.Data[ds.columnNames[i]]; !ok {
+				missing = append(missing, ds.columnNames[i])
+			}
+		}
+
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("  %s: missing %s", row.Location, strings.Join(missing, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return validationErrorf("Inconsistent columns in %s:\n%s", ds.TableName, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// StringValues returns a value per column for every row. Columns missing
+// from a row are set to DefaultValue.
+func (ds *DataSource) StringValues() ([]StringValue, error) {
+	if len(ds.stringValues) == 0 {
+		rows, err := ds.sourceRows()
+		if err != nil {
+			return ds.stringValues, err
+		}
+
+		names, err := ds.ColumnNames()
+		if err != nil {
+			return ds.stringValues, err
+		}
+
+		for _, row := range rows {
+			stringValue := NewStringValue()
+			for i, name := range names {
+				value, ok := row.Data[name]
+				if !ok {
+					value = DefaultValue{}
+				} else if column, described := ds.column(name); described {
+					coerced, err := coerceValue(column, value, row.Text, ds.options.TimeZone)
+					if err != nil {
+						return ds.stringValues, validationErrorf("%s: %s: %s", row.Location, name, err)
+					}
+					value = coerced
+				}
+
+				if err := stringValue.SetValue(i, value); err != nil {
+					return ds.stringValues, validationErrorf("%s: %s: %s", row.Location, name, err)
+				}
+			}
+
+			ds.stringValues = append(ds.stringValues, stringValue)
+		}
+	}
+
+	return ds.stringValues, nil
+}
+
+// KeyValues returns the values of the key columns for every source row.
+func (ds *DataSource) KeyValues(keys []string) ([][]interface{}, error) {
+	values := make([][]interface{}, 0, 0)
+
+	rows, err := ds.sourceRows()
+	if err != nil || len(rows) == 0 {
+		return values, err
+	}
+
+	columnNames, err := ds.ColumnNames()
+	if err != nil {
+		return values, err
+	}
+
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = -1
+		for idx, name := range columnNames {
+			if name == key {
+				indexes[i] = idx
+			}
+		}
+		if indexes[i] < 0 {
+			return values, validationErrorf("Primary key column %s not found in source: %s", key, ds.TableName)
+		}
+	}
+
+	stringValues, err := ds.StringValues()
+	if err != nil {
+		return values, err
+	}
+
+	for _, stringValue := range stringValues {
+		value := make([]interface{}, len(indexes))
+		for i, idx := range indexes {
+			if _, ok := stringValue.Values[idx].(DefaultValue); ok {
+				return values, validationErrorf("Primary key column %s missing in a row of %s", keys[i], ds.TableName)
+			}
+			value[i] = stringValue.Values[idx]
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// keyString returns a representation of key values comparable between
+// source rows and rows read from the database.
+func keyString(values []interface{}) string {
+	elements := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case float64:
+			elements[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case []byte:
+			elements[i] = string(v)
+		case nil:
+			elements[i] = "NULL"
+		default:
+			elements[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(elements, "\x00")
+}
+
+// ResolveBaseDir returns the absolute path of path, or of the master
+// directory of the working directory when path is empty.
+func ResolveBaseDir(path string) (string, error) {
+	if len(path) > 0 {
+		return filepath.Abs(path)
+	}
+
+	current, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(current, defaultBaseDirName), nil
+}
+
+// SelectDataSources returns the data sources of options.BaseDir, limited
+// to options.Tables when given.
+func SelectDataSources(options Options) ([]*DataSource, error) {
+	baseDir, err := ResolveBaseDir(options.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(baseDir); err != nil {
+		return nil, &SourceNotFoundError{Path: baseDir}
+	}
+
+	return targetDataSources(baseDir, options)
+}
+
+func targetDataSources(path string, options Options) ([]*DataSource, error) {
+	tableNames := options.Tables
+	sources, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sources) == 0 {
+		return nil, &SourceNotFoundError{Path: path}
+	}
+
+	var dataSources []*DataSource
+	tables := make(map[string]string)
+	for _, source := range sources {
+		if source.IsDir() || isTableFile(source.Name()) {
+			dataSource, err := NewDataSource(filepath.Join(path, source.Name()), options)
+			if err != nil {
+				return nil, err
+			}
+
+			selected := len(tableNames) == 0
+			for _, name := range tableNames {
+				if dataSource.TableName == name {
+					selected = true
+				}
+			}
+			if !selected {
+				continue
+			}
+
+			if other, ok := tables[dataSource.TableName]; ok {
+				return nil, validationErrorf("Duplicate sources for %s: %s, %s", dataSource.TableName, other, dataSource.Source)
+			}
+			tables[dataSource.TableName] = dataSource.Source
+			dataSources = append(dataSources, dataSource)
+		}
+	}
+
+	for _, name := range tableNames {
+		found := false
+		for _, dataSource := range dataSources {
+			if name == dataSource.TableName {
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, &SourceNotFoundError{Path: filepath.Join(path, name)}
+		}
+	}
+
+	return dataSources, nil
+}
+
+func isTableFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, tableExt := range tableExts {
+		if ext == tableExt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package masterimport
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectDataSourcesDuplicates(t *testing.T) {
+	baseDir := t.TempDir()
+	writeBaseDir(t, baseDir, map[string]string{
+		"items.csv":       "id\n1\n",
+		"users.csv":       "id\n1\n",
+		"users.ndjson":    "{\"id\": 1}\n",
+		"orders.ndjson":   "{\"id\": 1}\n",
+		"orders.tsv.orig": "id\n1\n",
+	})
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+	options.Tables = []string{"orders", "items"}
+	dataSources, err := SelectDataSources(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tableNames(dataSources); !reflect.DeepEqual(got, []string{"items", "orders"}) {
+		t.Errorf("tables = %q, want [items orders]", got)
+	}
+
+	options.Tables = nil
+	_, err = SelectDataSources(options)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("error = %v, want a ValidationError", err)
+	}
+}
@@ -0,0 +1,177 @@
+package masterimport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// defaultMySQLCharset is used unless a charset is given as a DSN parameter,
+// since the driver defaults to utf8, which can not store 4-byte characters.
+const defaultMySQLCharset = "utf8mb4"
+
+// Dialect holds the SQL syntax and connection settings that differ between
+// database servers.
+type Dialect interface {
+	DriverName() string
+	DataSourceName(db *Database, user string) string
+	QuoteIdentifier(name string) string
+	QuoteLiteral(value interface{}) string
+	Rebind(query string) string
+	TruncateQuery(table string) string
+	UpsertClause(table string, columns, keys []string) string
+	PrimaryKeyQuery(table string) Statement
+	ColumnsQuery(table string) Statement
+	TablesQuery() string
+	ForeignKeysQuery() string
+	ForeignKeyChecksQuery(enabled bool) string
+	MaxPacketQuery() string
+	MaxPlaceholders() int
+	ScriptHeader() []string
+	ScriptFooter() []string
+}
+
+// SequenceResetter is implemented by dialects whose truncation does not
+// reset auto increment sequences. The reset is only executed when
+// SequenceTableQuery returns a non-zero count.
+type SequenceResetter interface {
+	SequenceTableQuery() string
+	ResetSequenceQuery(table string) Statement
+}
+
+var dialects = map[string]Dialect{
+	DriverMySQL:    MySQLDialect{},
+	DriverPostgres: PostgresDialect{},
+	DriverSQLite:   SQLiteDialect{},
+}
+
+func LookupDialect(name string) (Dialect, error) {
+	if dialect, ok := dialects[name]; ok {
+		return dialect, nil
+	}
+
+	names := make([]string, 0, len(dialects))
+	for key := range dialects {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return nil, usageErrorf("Unknown driver: %s (available: %s)", name, strings.Join(names, ", "))
+}
+
+type MySQLDialect struct{}
+
+func (MySQLDialect) DriverName() string {
+	return DriverMySQL
+}
+
+func (MySQLDialect) DataSourceName(db *Database, user string) string {
+	if _, ok := db.Params["charset"]; !ok {
+		db.SetParam("charset", defaultMySQLCharset)
+	}
+
+	return fmt.Sprintf("%s:%s@%s/%s%s", user,
+		db.Password, db.address(), db.Name, db.dsnOptions())
+}
+
+func (MySQLDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (MySQLDialect) QuoteLiteral(value interface{}) string {
+	return quoteLiteral(value)
+}
+
+func (MySQLDialect) Rebind(query string) string {
+	return query
+}
+
+func (dialect MySQLDialect) TruncateQuery(table string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", dialect.QuoteIdentifier(table))
+}
+
+func (dialect MySQLDialect) UpsertClause(table string, columns, keys []string) string {
+	isKey := make(map[string]bool)
+	for _, key := range keys {
+		isKey[key] = true
+	}
+
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !isKey[column] {
+			quoted := dialect.QuoteIdentifier(column)
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", quoted, quoted))
+		}
+	}
+	if len(updates) == 0 {
+		quoted := dialect.QuoteIdentifier(keys[0])
+		updates = append(updates, fmt.Sprintf("%s = %s", quoted, quoted))
+	}
+
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+func (MySQLDialect) PrimaryKeyQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE" +
+			" WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'" +
+			" ORDER BY ORDINAL_POSITION",
+		Args: []interface{}{table},
+	}
+}
+
+func (MySQLDialect) ColumnsQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT COLUMN_NAME, IS_NULLABLE, COLUMN_DEFAULT IS NOT NULL OR EXTRA <> '', DATA_TYPE," +
+			" CHARACTER_MAXIMUM_LENGTH, COLUMN_TYPE FROM information_schema.COLUMNS" +
+			" WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		Args: []interface{}{table},
+	}
+}
+
+func (MySQLDialect) TablesQuery() string {
+	return "SELECT TABLE_NAME FROM information_schema.TABLES" +
+		" WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME"
+}
+
+func (MySQLDialect) ForeignKeysQuery() string {
+	return "SELECT TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE" +
+		" WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_SCHEMA = DATABASE()" +
+		" AND REFERENCED_TABLE_NAME IS NOT NULL"
+}
+
+func (MySQLDialect) ForeignKeyChecksQuery(enabled bool) string {
+	if enabled {
+		return "SET FOREIGN_KEY_CHECKS = 1"
+	}
+	return "SET FOREIGN_KEY_CHECKS = 0"
+}
+
+func (MySQLDialect) MaxPacketQuery() string {
+	return "SELECT @@max_allowed_packet"
+}
+
+func (MySQLDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func (dialect MySQLDialect) ScriptHeader() []string {
+	return []string{"SET NAMES utf8mb4", dialect.ForeignKeyChecksQuery(false), "START TRANSACTION"}
+}
+
+func (dialect MySQLDialect) ScriptFooter() []string {
+	return []string{"COMMIT", dialect.ForeignKeyChecksQuery(true)}
+}
+
+// quoteIdentifiers quotes every name and joins them with commas.
+func quoteIdentifiers(dialect Dialect, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = dialect.QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
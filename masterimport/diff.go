@@ -0,0 +1,222 @@
+package masterimport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TableDiff struct {
+	Table   string    `json:"table"`
+	Keys    []string  `json:"keys"`
+	Added   []RowDiff `json:"added"`
+	Removed []RowDiff `json:"removed"`
+	Changed []RowDiff `json:"changed"`
+}
+
+type RowDiff struct {
+	Key     []interface{}  `json:"key"`
+	Changes []ColumnChange `json:"changes,omitempty"`
+}
+
+type ColumnChange struct {
+	Column string      `json:"column"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+func (diff TableDiff) HasChanges() bool {
+	return len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0
+}
+
+// DiffTable compares the source rows of dataSource with the rows of the
+// table matched by primary key. Source values are coerced by the column
+// types of the table as they are on load. Columns absent from the source
+// are ignored.
+func (db *Database) DiffTable(ctx context.Context, dataSource *DataSource) (TableDiff, error) {
+	diff := TableDiff{
+		Table:   dataSource.TableName,
+		Added:   make([]RowDiff, 0, 0),
+		Removed: make([]RowDiff, 0, 0),
+		Changed: make([]RowDiff, 0, 0),
+	}
+
+	dialect, err := db.Dialect()
+	if err != nil {
+		return diff, err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return diff, err
+	}
+	defer db.release(sqlDB)
+
+	if dataSource.columns == nil {
+		if err := db.describeSource(ctx, sqlDB, dialect, dataSource); err != nil {
+			return diff, err
+		}
+	}
+
+	columnNames, err := dataSource.ColumnNames()
+	if err != nil {
+		return diff, err
+	}
+
+	stringValues, err := dataSource.StringValues()
+	if err != nil {
+		return diff, err
+	}
+
+	keys, err := db.primaryKeyColumns(ctx, sqlDB, dataSource.TableName)
+	if err != nil {
+		return diff, err
+	}
+	if len(keys) == 0 {
+		return diff, validationErrorf("Primary key not found: %s", dataSource.TableName)
+	}
+	diff.Keys = keys
+
+	sourceKeys, err := dataSource.KeyValues(keys)
+	if err != nil {
+		return diff, err
+	}
+
+	columns, rows, err := db.selectRows(ctx, sqlDB, dataSource.TableName, keys)
+	if err != nil {
+		return diff, err
+	}
+
+	columnIndexes := make(map[string]int)
+	for i, column := range columns {
+		columnIndexes[column] = i
+	}
+
+	current := make(map[string][]interface{})
+	currentKeys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		key := make([]interface{}, len(keys))
+		for i, name := range keys {
+			key[i] = row[columnIndexes[name]]
+		}
+		current[keyString(key)] = row
+		currentKeys = append(currentKeys, keyString(key))
+	}
+
+	seen := make(map[string]bool)
+	for i, stringValue := range stringValues {
+		key := keyString(sourceKeys[i])
+		seen[key] = true
+
+		row, ok := current[key]
+		if !ok {
+			diff.Added = append(diff.Added, RowDiff{Key: sourceKeys[i]})
+			continue
+		}
+
+		changes := make([]ColumnChange, 0, 0)
+		for idx := 0; idx < len(columnNames); idx++ {
+			name := columnNames[idx]
+			value := stringValue.Values[idx]
+			if _, ok := value.(DefaultValue); ok {
+				continue
+			}
+
+			columnIndex, ok := columnIndexes[name]
+			if !ok {
+				return diff, validationErrorf("Unknown column %s in %s", name, dataSource.TableName)
+			}
+
+			column, _ := dataSource.column(name)
+			if !sameValue(column, dataSource.options.TimeZone, row[columnIndex], value) {
+				changes = append(changes, ColumnChange{Column: name, Old: row[columnIndex], New: value})
+			}
+		}
+
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, RowDiff{Key: sourceKeys[i], Changes: changes})
+		}
+	}
+
+	for _, key := range currentKeys {
+		if !seen[key] {
+			row := current[key]
+			values := make([]interface{}, len(keys))
+			for i, name := range keys {
+				values[i] = row[columnIndexes[name]]
+			}
+			diff.Removed = append(diff.Removed, RowDiff{Key: values})
+		}
+	}
+
+	return diff, nil
+}
+
+// sameValue compares a database value of column with a coerced source
+// value. The database value is coerced the same way, so that date and time
+// values compare in location. JSON documents are compared by content and
+// numbers that are numerically equal are treated as the same.
+func sameValue(column Column, location *time.Location, current, source interface{}) bool {
+	if current == nil || source == nil {
+		return current == nil && source == nil
+	}
+
+	if coerced, err := coerceValue(column, current, false, location); err == nil {
+		current = coerced
+	}
+	if column.DataType == "json" || column.DataType == "jsonb" {
+		var a, b interface{}
+		aErr := json.Unmarshal([]byte(fmt.Sprint(current)), &a)
+		bErr := json.Unmarshal([]byte(fmt.Sprint(source)), &b)
+		if aErr == nil && bErr == nil {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+
+	a := keyString([]interface{}{current})
+	b := keyString([]interface{}{source})
+	if a == b {
+		return true
+	}
+
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	return aErr == nil && bErr == nil && af == bf
+}
+
+// WriteDiffText writes the keys of added, removed and changed rows of diffs
+// in a human readable form.
+func WriteDiffText(writer io.Writer, diffs []TableDiff) {
+	for _, diff := range diffs {
+		if !diff.HasChanges() {
+			continue
+		}
+
+		fmt.Fprintf(writer, "%s:\n", diff.Table)
+		for _, row := range diff.Added {
+			fmt.Fprintf(writer, "  + %s\n", formatKey(diff.Keys, row.Key))
+		}
+		for _, row := range diff.Removed {
+			fmt.Fprintf(writer, "  - %s\n", formatKey(diff.Keys, row.Key))
+		}
+		for _, row := range diff.Changed {
+			fmt.Fprintf(writer, "  ~ %s\n", formatKey(diff.Keys, row.Key))
+			for _, change := range row.Changes {
+				fmt.Fprintf(writer, "      %s: %s -> %s\n", change.Column, quoteLiteral(change.Old), quoteLiteral(change.New))
+			}
+		}
+	}
+}
+
+func formatKey(keys []string, values []interface{}) string {
+	elements := make([]string, len(keys))
+	for i, key := range keys {
+		elements[i] = fmt.Sprintf("%s=%s", key, quoteLiteral(values[i]))
+	}
+	return strings.Join(elements, ", ")
+}
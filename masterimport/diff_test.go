@@ -0,0 +1,76 @@
+package masterimport
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+const diffSchema = `
+CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price REAL);
+INSERT INTO items VALUES (1, 'apple', 1.5), (2, 'banana', 2), (3, 'cherry', 3);
+`
+
+func diffItems(t *testing.T, source string) (TableDiff, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqlDB, err := sql.Open(DriverSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	if _, err := sqlDB.Exec(diffSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	baseDir := t.TempDir()
+	writeBaseDir(t, baseDir, map[string]string{"items.csv": source})
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+	dataSources, err := SelectDataSources(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &Database{Driver: DriverSQLite, Name: path}
+	return db.DiffTable(context.Background(), dataSources[0])
+}
+
+func TestDiffTable(t *testing.T) {
+	diff, err := diffItems(t, "id,name,price\n1,apple,1.50\n2,bananas,2\n4,date,4\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	WriteDiffText(&buf, []TableDiff{diff})
+	want := "items:\n" +
+		"  + id='4'\n" +
+		"  - id=3\n" +
+		"  ~ id='2'\n" +
+		"      name: 'banana' -> 'bananas'\n"
+	if got := buf.String(); got != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	diff, err = diffItems(t, "id,name,price\n1,apple,1.5\n2,banana,2\n3,cherry,3\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.HasChanges() {
+		t.Errorf("diff of unchanged rows = %+v", diff)
+	}
+}
+
+func TestDiffTableUnknownColumn(t *testing.T) {
+	_, err := diffItems(t, "id,name,color\n1,apple,red\n")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("error = %v, want a ValidationError", err)
+	}
+}
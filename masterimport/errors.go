@@ -0,0 +1,112 @@
+package masterimport
+
+import "fmt"
+
+// UsageError reports an invalid flag or flag value.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// SourceNotFoundError reports a missing base directory or table source.
+type SourceNotFoundError struct {
+	Path string
+}
+
+func (e *SourceNotFoundError) Error() string {
+	return fmt.Sprintf("Source not found: %s", e.Path)
+}
+
+// ParseError reports a source file that can not be read. Line is set for
+// line oriented files and Row for files holding an array of rows; both are
+// zero when the position is unknown.
+type ParseError struct {
+	File string
+	Line int
+	Row  int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.Line > 0:
+		return fmt.Sprintf("%s: line %d: %s", e.File, e.Line, e.Err)
+	case e.Row > 0:
+		return fmt.Sprintf("%s: row %d: %s", e.File, e.Row, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports source rows that do not fit the columns of the
+// sources or of the target table.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func validationErrorf(format string, args ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ConnectionError reports a failure to connect to the database.
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("Can't connect to the database: %s", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// SQLError reports a failed statement. Table is empty for statements that
+// do not target a single table. Batch is the position of the statement
+// among the batches of the table, or zero for statements that are not
+// batched.
+type SQLError struct {
+	Table string
+	Batch int
+	Err   error
+}
+
+func (e *SQLError) Error() string {
+	switch {
+	case len(e.Table) == 0:
+		return e.Err.Error()
+	case e.Batch > 0:
+		return fmt.Sprintf("%s: batch %d: %s", e.Table, e.Batch, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Table, e.Err)
+}
+
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// sqlError wraps err as an SQLError of table unless it is nil or already
+// typed.
+func sqlError(table string, batch int, err error) error {
+	switch err.(type) {
+	case nil:
+		return nil
+	case *SQLError, *ConnectionError, *ValidationError, *ParseError:
+		return err
+	}
+	return &SQLError{Table: table, Batch: batch, Err: err}
+}
@@ -0,0 +1,406 @@
+package masterimport
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+	FormatTSV    = "tsv"
+)
+
+const fileNameDelimiter = "_"
+
+// TableNames returns the base tables of the database in name order.
+func (db *Database) TableNames(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, 0)
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return names, err
+	}
+	defer db.release(sqlDB)
+
+	dialect, err := db.Dialect()
+	if err != nil {
+		return names, err
+	}
+
+	rows, err := sqlDB.QueryContext(ctx, dialect.TablesQuery())
+	if err != nil {
+		return names, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// ExportTable writes every row of table under baseDir in the layout
+// DataSource reads. Row files are named after the primary key and existing
+// source files of the table are replaced.
+func (db *Database) ExportTable(ctx context.Context, baseDir, table, format string) error {
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	keys, err := db.primaryKeyColumns(ctx, sqlDB, table)
+	if err != nil {
+		return err
+	}
+
+	columns, rows, err := db.selectRows(ctx, sqlDB, table, keys)
+	if err != nil {
+		return err
+	}
+
+	if err := removeTableSources(baseDir, table); err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJSON, FormatYAML:
+		dir := filepath.Join(baseDir, table)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		for i, row := range rows {
+			name := rowFileName(columns, keys, row, i)
+			var content []byte
+			if format == FormatJSON {
+				content, err = marshalJSONRow(columns, row, "  ")
+			} else {
+				content, err = marshalYAMLRow(columns, row)
+			}
+			if err != nil {
+				return err
+			}
+
+			path := filepath.Join(dir, name+"."+format)
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatNDJSON:
+		var buf bytes.Buffer
+		for _, row := range rows {
+			content, err := marshalJSONRow(columns, row, "")
+			if err != nil {
+				return err
+			}
+			buf.Write(content)
+		}
+		return ioutil.WriteFile(filepath.Join(baseDir, table+ndjsonExt), buf.Bytes(), 0644)
+	case FormatCSV, FormatTSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		ext := csvExt
+		if format == FormatTSV {
+			writer.Comma = '\t'
+			ext = tsvExt
+		}
+
+		writer.Write(columns)
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, value := range row {
+				if value != nil {
+					record[i] = formatValue(value)
+					if len(record[i]) == 0 {
+						return validationErrorf("%s: empty %s can not be told from NULL in %s; use json, yaml or ndjson", table, columns[i], format)
+					}
+				}
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(baseDir, table+ext), buf.Bytes(), 0644)
+	}
+
+	return usageErrorf("Unknown format: %s", format)
+}
+
+// selectRows returns the column names and the rows of table ordered by
+// keys. Values are converted to Go types according to the column types
+// read from the dialect's ColumnsQuery, since not every driver reports
+// them with the result set.
+func (db *Database) selectRows(ctx context.Context, sqlDB *sql.DB, table string, keys []string) ([]string, [][]interface{}, error) {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tableColumns, err := db.tableColumns(ctx, sqlDB, dialect, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataTypes := make(map[string]string)
+	for _, column := range tableColumns {
+		dataTypes[column.Name] = column.DataType
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", dialect.QuoteIdentifier(table))
+	if len(keys) > 0 {
+		query += " ORDER BY " + quoteIdentifiers(dialect, keys)
+	}
+
+	rows, err := sqlDB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([][]interface{}, 0, 0)
+	for rows.Next() {
+		raw := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]interface{}, len(columns))
+		for i, b := range raw {
+			typeName, ok := dataTypes[columns[i]]
+			if !ok {
+				typeName = columnTypes[i].DatabaseTypeName()
+			}
+			row[i] = convertColumnValue(typeName, b)
+		}
+		values = append(values, row)
+	}
+
+	return columns, values, rows.Err()
+}
+
+func convertColumnValue(typeName string, b sql.RawBytes) interface{} {
+	if b == nil {
+		return nil
+	}
+
+	value := string(b)
+	switch strings.ToUpper(typeName) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR", "INT2", "INT4", "INT8", "INTEGER":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return u
+		}
+	case "FLOAT", "DOUBLE", "FLOAT4", "FLOAT8", "REAL", "DOUBLE PRECISION":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "DECIMAL", "NUMERIC":
+		return json.Number(value)
+	case "JSON", "JSONB":
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		var decoded interface{}
+		if err := decoder.Decode(&decoded); err == nil {
+			return decoded
+		}
+	case "BOOL", "BOOLEAN":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BYTEA":
+		return append([]byte(nil), b...)
+	}
+	return value
+}
+
+// formatValue renders value as text. Binary values are base64 encoded, as
+// expected by the coercion of binary columns, and JSON documents are
+// written as JSON text.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case map[string]interface{}, []interface{}:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// rowFileName joins the primary key values of row, falling back to the row
+// number when the table has no primary key.
+func rowFileName(columns, keys []string, row []interface{}, index int) string {
+	if len(keys) == 0 {
+		return strconv.Itoa(index + 1)
+	}
+
+	elements := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for i, column := range columns {
+			if column == key {
+				elements = append(elements, formatValue(row[i]))
+			}
+		}
+	}
+
+	name := strings.Join(elements, fileNameDelimiter)
+	return strings.NewReplacer("/", fileNameDelimiter, string(filepath.Separator), fileNameDelimiter).Replace(name)
+}
+
+// marshalJSONRow renders row as a JSON object keeping the column order.
+func marshalJSONRow(columns []string, row []interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if len(indent) > 0 {
+			buf.WriteString("\n" + indent)
+		}
+
+		name, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteString(":")
+		if len(indent) > 0 {
+			buf.WriteString(" ")
+		}
+		buf.Write(value)
+	}
+	if len(indent) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+
+	return buf.Bytes(), nil
+}
+
+func marshalYAMLRow(columns []string, row []interface{}) ([]byte, error) {
+	slice := make(yaml.MapSlice, len(columns))
+	for i, column := range columns {
+		value := row[i]
+		switch v := value.(type) {
+		case json.Number:
+			value = string(v)
+		case []byte:
+			value = formatValue(v)
+		case map[string]interface{}, []interface{}:
+			value = yamlValue(v)
+		}
+		slice[i] = yaml.MapItem{Key: column, Value: value}
+	}
+	return yaml.Marshal(slice)
+}
+
+// yamlValue converts the json.Number values of a decoded JSON document to
+// numbers that the YAML encoder writes as plain scalars.
+func yamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, item := range v {
+			m[key] = yamlValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = yamlValue(item)
+		}
+		return s
+	}
+	return value
+}
+
+// removeTableSources removes the files DataSource would read for table in
+// either layout, and the row directory once it is empty, so that rows
+// deleted from the database do not survive an export and the table is not
+// left with two sources.
+func removeTableSources(baseDir, table string) error {
+	for _, ext := range tableExts {
+		path := filepath.Join(baseDir, table+ext)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	dir := filepath.Join(baseDir, table)
+	for _, ext := range sourceExts {
+		files, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 0 {
+		return os.Remove(dir)
+	}
+	return nil
+}
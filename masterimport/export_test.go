@@ -0,0 +1,112 @@
+package masterimport
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const exportSchema = `
+CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price REAL, note TEXT);
+CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+INSERT INTO items VALUES (1, 'it''s', 1.5, NULL), (2, 'line
+break', NULL, '🍣'), (10, 'x,"y"', 0.25, '{"a": 1}');
+`
+
+// tableContents returns the rows of query with the values of each row
+// joined by "|" and NULL written as NULL.
+func tableContents(t *testing.T, sqlDB *sql.DB, query string) []string {
+	t.Helper()
+
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]string, 0, 0)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatal(err)
+		}
+
+		elements := make([]string, len(values))
+		for i, value := range values {
+			elements[i] = "NULL"
+			if value.Valid {
+				elements[i] = value.String
+			}
+		}
+		result = append(result, strings.Join(elements, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	for _, format := range []string{FormatJSON, FormatYAML, FormatNDJSON, FormatCSV, FormatTSV} {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db := &Database{Driver: DriverSQLite, Name: path}
+		sqlDB, err := sql.Open(DriverSQLite, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+		if _, err := sqlDB.Exec(exportSchema); err != nil {
+			t.Fatal(err)
+		}
+		want := tableContents(t, sqlDB, "SELECT * FROM items ORDER BY id")
+
+		// Sources left by an export in the other layout are replaced.
+		baseDir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(baseDir, "items"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeBaseDir(t, baseDir, map[string]string{
+			"items/3.json": "{\"id\": 3, \"name\": \"deleted\"}\n",
+			"items.tsv":    "id\tname\n3\tdeleted\n",
+			"tags.ndjson":  "{\"id\": 1, \"name\": \"deleted\"}\n",
+		})
+
+		for _, table := range []string{"items", "tags"} {
+			if err := db.ExportTable(ctx, baseDir, table, format); err != nil {
+				t.Fatalf("%s: export %s: %s", format, table, err)
+			}
+		}
+
+		if _, err := sqlDB.Exec("DELETE FROM items; INSERT INTO tags VALUES (1, 'stale')"); err != nil {
+			t.Fatal(err)
+		}
+
+		options := DefaultOptions()
+		options.BaseDir = baseDir
+		if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+			t.Fatalf("%s: import: %s", format, err)
+		}
+
+		if got := tableContents(t, sqlDB, "SELECT * FROM items ORDER BY id"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: items = %q, want %q", format, got, want)
+		}
+		if got := tableContents(t, sqlDB, "SELECT * FROM tags"); len(got) != 0 {
+			t.Errorf("%s: tags = %q, want no rows", format, got)
+		}
+	}
+}
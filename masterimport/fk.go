@@ -0,0 +1,145 @@
+package masterimport
+
+import (
+	"context"
+	"strings"
+)
+
+// ForeignKeys returns the tables each table references, keyed by the
+// referencing table.
+func (db *Database) ForeignKeys(ctx context.Context) (map[string][]string, error) {
+	references := make(map[string][]string)
+
+	dialect, err := db.Dialect()
+	if err != nil {
+		return references, err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return references, err
+	}
+	defer db.release(sqlDB)
+
+	return db.foreignKeys(ctx, sqlDB, dialect)
+}
+
+func (db *Database) foreignKeys(ctx context.Context, sqlDB queryer, dialect Dialect) (map[string][]string, error) {
+	references := make(map[string][]string)
+
+	rows, err := sqlDB.QueryContext(ctx, dialect.ForeignKeysQuery())
+	if err != nil {
+		return references, sqlError("", 0, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return references, sqlError("", 0, err)
+		}
+		references[table] = append(references[table], referenced)
+	}
+
+	return references, sqlError("", 0, rows.Err())
+}
+
+// SortDataSources orders dataSources so that referenced tables come before
+// the tables referencing them, keeping the given order otherwise.
+// References to tables outside dataSources and to the table itself are
+// ignored. A reference cycle is reported as a ValidationError.
+func SortDataSources(dataSources []*DataSource, references map[string][]string) ([]*DataSource, error) {
+	selected := make(map[string]bool)
+	for _, dataSource := range dataSources {
+		selected[dataSource.TableName] = true
+	}
+
+	parents := make(map[string][]string)
+	for _, dataSource := range dataSources {
+		table := dataSource.TableName
+		for _, referenced := range references[table] {
+			if referenced != table && selected[referenced] {
+				parents[table] = append(parents[table], referenced)
+			}
+		}
+	}
+
+	sorted := make([]*DataSource, 0, len(dataSources))
+	done := make(map[string]bool)
+	for len(sorted) < len(dataSources) {
+		progress := false
+		for _, dataSource := range dataSources {
+			if done[dataSource.TableName] {
+				continue
+			}
+
+			ready := true
+			for _, parent := range parents[dataSource.TableName] {
+				if !done[parent] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				done[dataSource.TableName] = true
+				sorted = append(sorted, dataSource)
+				progress = true
+				break
+			}
+		}
+
+		if !progress {
+			return sorted, validationErrorf("Foreign key cycle: %s", strings.Join(findCycle(parents, done), " -> "))
+		}
+	}
+
+	return sorted, nil
+}
+
+// hasReferences reports whether any table of dataSources references another
+// one of them.
+func hasReferences(dataSources []*DataSource, references map[string][]string) bool {
+	selected := make(map[string]bool)
+	for _, dataSource := range dataSources {
+		selected[dataSource.TableName] = true
+	}
+
+	for _, dataSource := range dataSources {
+		for _, referenced := range references[dataSource.TableName] {
+			if referenced != dataSource.TableName && selected[referenced] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findCycle returns a reference cycle among the tables not yet done.
+func findCycle(parents map[string][]string, done map[string]bool) []string {
+	var start string
+	for table := range parents {
+		if !done[table] && (len(start) == 0 || table < start) {
+			start = table
+		}
+	}
+
+	path := []string{start}
+	index := map[string]int{start: 0}
+	for {
+		current := path[len(path)-1]
+		next := ""
+		for _, parent := range parents[current] {
+			if !done[parent] {
+				next = parent
+				break
+			}
+		}
+
+		if i, ok := index[next]; ok {
+			return append(path[i:], next)
+		}
+		index[next] = len(path)
+		path = append(path, next)
+	}
+}
@@ -0,0 +1,113 @@
+package masterimport
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func tableNames(dataSources []*DataSource) []string {
+	names := make([]string, len(dataSources))
+	for i, dataSource := range dataSources {
+		names[i] = dataSource.TableName
+	}
+	return names
+}
+
+func TestSortDataSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		tables     []string
+		references map[string][]string
+		want       []string
+	}{
+		{
+			name:       "no references",
+			tables:     []string{"b", "a"},
+			references: map[string][]string{},
+			want:       []string{"b", "a"},
+		},
+		{
+			name:       "parent first",
+			tables:     []string{"items", "users", "orders"},
+			references: map[string][]string{"orders": {"users", "items"}},
+			want:       []string{"items", "users", "orders"},
+		},
+		{
+			name:       "chain",
+			tables:     []string{"c", "b", "a"},
+			references: map[string][]string{"c": {"b"}, "b": {"a"}},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name:       "self and unselected references",
+			tables:     []string{"tree", "orders"},
+			references: map[string][]string{"tree": {"tree"}, "orders": {"users"}},
+			want:       []string{"tree", "orders"},
+		},
+	}
+
+	for _, test := range tests {
+		dataSources := make([]*DataSource, len(test.tables))
+		for i, table := range test.tables {
+			dataSources[i] = &DataSource{TableName: table}
+		}
+
+		sorted, err := SortDataSources(dataSources, test.references)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := tableNames(sorted); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: order = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSortDataSourcesCycle(t *testing.T) {
+	dataSources := []*DataSource{{TableName: "a"}, {TableName: "x"}, {TableName: "y"}}
+	references := map[string][]string{"x": {"y"}, "y": {"x"}}
+
+	sorted, err := SortDataSources(dataSources, references)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want a ValidationError", err)
+	}
+	if got := tableNames(sorted); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("sorted before the cycle = %q, want [a]", got)
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		parents map[string][]string
+		done    map[string]bool
+		want    []string
+	}{
+		{
+			name:    "two tables",
+			parents: map[string][]string{"x": {"y"}, "y": {"x"}},
+			done:    map[string]bool{},
+			want:    []string{"x", "y", "x"},
+		},
+		{
+			name:    "tail into cycle",
+			parents: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}},
+			done:    map[string]bool{},
+			want:    []string{"b", "c", "d", "b"},
+		},
+		{
+			name:    "done parents skipped",
+			parents: map[string][]string{"p": {"done", "q"}, "q": {"p"}},
+			done:    map[string]bool{"done": true},
+			want:    []string{"p", "q", "p"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := findCycle(test.parents, test.done); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: cycle = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
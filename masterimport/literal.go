@@ -0,0 +1,89 @@
+package masterimport
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const datetimeFormat = "2006-01-02 15:04:05.999999"
+
+var literalReplacer = strings.NewReplacer(
+	"\x00", `\0`,
+	"'", `\'`,
+	`"`, `\"`,
+	"\b", `\b`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+	"\x1a", `\Z`,
+	`\`, `\\`,
+)
+
+// Interpolate returns the query with every ? or $n placeholder replaced by
+// the corresponding argument rendered as a literal of dialect.
+func (stmt Statement) Interpolate(dialect Dialect) string {
+	if len(stmt.Args) == 0 {
+		return stmt.Query
+	}
+
+	var buf strings.Builder
+	query := stmt.Query
+	arg := 0
+	for i := 0; i < len(query); i++ {
+		switch {
+		case query[i] == '?' && arg < len(stmt.Args):
+			buf.WriteString(dialect.QuoteLiteral(stmt.Args[arg]))
+			arg++
+			continue
+		case query[i] == '$':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(query[i+1 : j]); err == nil && n > 0 && n <= len(stmt.Args) {
+				buf.WriteString(dialect.QuoteLiteral(stmt.Args[n-1]))
+				i = j - 1
+				continue
+			}
+		}
+		buf.WriteByte(query[i])
+	}
+	return buf.String()
+}
+
+// quoteLiteral renders value as a MySQL literal.
+func quoteLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case DefaultValue:
+		return "DEFAULT"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case json.Number:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return "'" + v.Format(datetimeFormat) + "'"
+	case string:
+		return "'" + literalReplacer.Replace(v) + "'"
+	default:
+		return "'" + literalReplacer.Replace(fmt.Sprint(v)) + "'"
+	}
+}
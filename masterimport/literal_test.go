@@ -0,0 +1,70 @@
+package masterimport
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "NULL"},
+		{DefaultValue{}, "DEFAULT"},
+		{true, "TRUE"},
+		{int64(-42), "-42"},
+		{json.Number("12345678901234567890"), "12345678901234567890"},
+		{1.5, "1.5"},
+		{[]byte{0x00, 0xff}, "X'00ff'"},
+		{"it's", `'it\'s'`},
+		{`say "hi"`, `'say \"hi\"'`},
+		{`C:\path`, `'C:\\path'`},
+		{"nul\x00byte", `'nul\0byte'`},
+		{"line\nbreak\r\ttab", `'line\nbreak\r\ttab'`},
+		{"\x1a\b", `'\Z\b'`},
+		{`\'`, `'\\\''`},
+		{"🍣", "'🍣'"},
+	}
+
+	for _, test := range tests {
+		if got := quoteLiteral(test.value); got != test.want {
+			t.Errorf("quoteLiteral(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		stmt    Statement
+		want    string
+	}{
+		{
+			MySQLDialect{},
+			Statement{Query: "INSERT INTO t VALUES (?, ?, DEFAULT)", Args: []interface{}{"a?b", nil}},
+			`INSERT INTO t VALUES ('a?b', NULL, DEFAULT)`,
+		},
+		{
+			PostgresDialect{},
+			Statement{Query: "INSERT INTO t VALUES ($1, $2), ($10)", Args: []interface{}{"it's", `\`, 3, 4, 5, 6, 7, 8, 9, "$1"}},
+			`INSERT INTO t VALUES ('it''s', '\'), ('$1')`,
+		},
+		{
+			SQLiteDialect{},
+			Statement{Query: "INSERT INTO t VALUES (?, ?)", Args: []interface{}{true, []byte("hi")}},
+			`INSERT INTO t VALUES (1, X'6869')`,
+		},
+		{
+			MySQLDialect{},
+			Statement{Query: "TRUNCATE TABLE t"},
+			"TRUNCATE TABLE t",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.stmt.Interpolate(test.dialect); got != test.want {
+			t.Errorf("Interpolate(%q) = %s, want %s", test.stmt.Query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package masterimport
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	infileNull        = `\N`
+	readerPrefix      = "Reader::"
+	readerPattern     = AppName + "-%s"
+	warningCountQuery = "SELECT @@warning_count"
+)
+
+// MySQL error numbers returned when LOAD DATA LOCAL INFILE is disabled on
+// the server.
+const (
+	errNotAllowedCommand  = 1148
+	errLocalInfileDisable = 3948
+)
+
+var infileReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	"\x00", `\0`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+// InfileLoader is implemented by dialects that can bulk load rows from a
+// tab separated stream.
+type InfileLoader interface {
+	LoadDataQuery(reader, table string, columns []string) string
+}
+
+func (dialect MySQLDialect) LoadDataQuery(reader, table string, columns []string) string {
+	return fmt.Sprintf("LOAD DATA LOCAL INFILE '%s' INTO TABLE %s CHARACTER SET utf8mb4"+
+		` FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%s)`,
+		readerPrefix+reader, dialect.QuoteIdentifier(table), quoteIdentifiers(dialect, columns))
+}
+
+// canLoadInfile reports whether dataSource is large enough for the
+// LOAD DATA fast path and every row can be expressed in it.
+func canLoadInfile(dialect Dialect, dataSource *DataSource) (bool, error) {
+	if _, ok := dialect.(InfileLoader); !ok || dataSource.options.InfileThreshold <= 0 {
+		return false, nil
+	}
+
+	stringValues, err := dataSource.StringValues()
+	if err != nil {
+		return false, err
+	}
+	if len(stringValues) < dataSource.options.InfileThreshold {
+		return false, nil
+	}
+
+	for _, stringValue := range stringValues {
+		for _, value := range stringValue.Values {
+			if _, ok := value.(DefaultValue); ok {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// loadInfile streams the rows of the builder's data source through a
+// registered reader handler. It returns false without error when the server
+// does not allow local infile so the caller can fall back to INSERT. Since
+// LOCAL turns duplicate keys and invalid values into warnings, a load that
+// skipped rows or raised warnings is reported as an error.
+func (db *Database) loadInfile(ctx context.Context, tx *sql.Tx, queryBuilder QueryBuilder) (bool, error) {
+	loader := queryBuilder.dialect.(InfileLoader)
+	dataSource := queryBuilder.dataSource
+
+	columnNames, err := dataSource.ColumnNames()
+	if err != nil {
+		return false, err
+	}
+	columns := make([]string, len(columnNames))
+	for i := 0; i < len(columnNames); i++ {
+		columns[i] = columnNames[i]
+	}
+
+	stringValues, err := dataSource.StringValues()
+	if err != nil {
+		return false, err
+	}
+
+	name := fmt.Sprintf(readerPattern, dataSource.TableName)
+	mysql.RegisterReaderHandler(name, func() io.Reader {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(writeInfile(writer, stringValues))
+		}()
+		return reader
+	})
+	defer mysql.DeregisterReaderHandler(name)
+
+	result, err := tx.ExecContext(ctx, loader.LoadDataQuery(name, dataSource.TableName, columns))
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		if mysqlErr.Number == errNotAllowedCommand || mysqlErr.Number == errLocalInfileDisable {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	var warnings int
+	if err := tx.QueryRowContext(ctx, warningCountQuery).Scan(&warnings); err != nil {
+		return false, err
+	}
+
+	if affected != int64(len(stringValues)) || warnings > 0 {
+		return false, fmt.Errorf("LOAD DATA loaded %d of %d rows with %d warnings", affected, len(stringValues), warnings)
+	}
+	return true, nil
+}
+
+// writeInfile writes one line per row with tab separated, escaped fields
+// and \N for NULL.
+func writeInfile(writer io.Writer, stringValues []StringValue) error {
+	buf := bufio.NewWriter(writer)
+	for _, stringValue := range stringValues {
+		for i := 0; i < len(stringValue.Values); i++ {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(infileValue(stringValue.Values[i]))
+		}
+		if err := buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+func infileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return infileNull
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case json.Number:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return infileReplacer.Replace(string(v))
+	case string:
+		return infileReplacer.Replace(v)
+	default:
+		return infileReplacer.Replace(fmt.Sprint(v))
+	}
+}
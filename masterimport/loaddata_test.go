@@ -0,0 +1,64 @@
+package masterimport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func stringValueOf(values ...interface{}) StringValue {
+	stringValue := NewStringValue()
+	for i, value := range values {
+		stringValue.Values[i] = value
+	}
+	return stringValue
+}
+
+func TestWriteInfile(t *testing.T) {
+	stringValues := []StringValue{
+		stringValueOf(1, "plain", nil, true),
+		stringValueOf(2, "tab\tnew\nline\rcr", 1.5, false),
+		stringValueOf(3, `back\slash`+"\x00nul", "\\N", "🍣"),
+	}
+
+	var buf bytes.Buffer
+	if err := writeInfile(&buf, stringValues); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "1\tplain\t\\N\t1\n" +
+		"2\ttab\\tnew\\nline\\rcr\t1.5\t0\n" +
+		"3\tback\\\\slash\\0nul\t\\\\N\t🍣\n"
+	if got := buf.String(); got != want {
+		t.Errorf("infile = %q, want %q", got, want)
+	}
+}
+
+func TestCanLoadInfile(t *testing.T) {
+	rows := []StringValue{stringValueOf(1, "a"), stringValueOf(2, "b")}
+	withDefault := []StringValue{stringValueOf(1, "a"), stringValueOf(2, DefaultValue{})}
+
+	tests := []struct {
+		name         string
+		dialect      Dialect
+		threshold    int
+		stringValues []StringValue
+		want         bool
+	}{
+		{"disabled", MySQLDialect{}, 0, rows, false},
+		{"below threshold", MySQLDialect{}, 3, rows, false},
+		{"at threshold", MySQLDialect{}, 2, rows, true},
+		{"column defaults", MySQLDialect{}, 2, withDefault, false},
+		{"unsupported dialect", PostgresDialect{}, 2, rows, false},
+	}
+
+	for _, test := range tests {
+		options := DefaultOptions()
+		options.InfileThreshold = test.threshold
+		got, err := canLoadInfile(test.dialect, &DataSource{options: options, stringValues: test.stringValues})
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: canLoadInfile = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package masterimport
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Options control how sources are selected, read and loaded.
+type Options struct {
+	// BaseDir holds a source per table. It defaults to the master
+	// directory of the working directory.
+	BaseDir string
+	// Tables limits loading to the named tables. Every source of BaseDir
+	// is loaded when it is empty.
+	Tables []string
+	// Mode is ImportModeTruncate or ImportModeUpsert.
+	Mode string
+	// BatchSize is the number of rows per statement. When it is zero, rows
+	// are packed until a statement reaches MaxQueryBytes, which defaults to
+	// the largest statement the server accepts.
+	BatchSize     int
+	MaxQueryBytes int
+	// InfileThreshold is the row count from which tables are loaded with
+	// LOAD DATA LOCAL INFILE, or zero to never use it.
+	InfileThreshold int
+	ColumnMode      string
+	ColumnOrder     string
+	CSVEmptyAsNull  bool
+	// SortKeys are the columns rows are sorted by.
+	SortKeys                []string
+	DeleteMissing           bool
+	Atomic                  bool
+	Swap                    bool
+	KeepOld                 bool
+	Validate                bool
+	DisableForeignKeyChecks bool
+	// TimeZone is the location ISO-8601 timestamps are converted to before
+	// they are stored in DATETIME and DATE columns.
+	TimeZone *time.Location
+}
+
+// DefaultOptions returns the options used by the command line tool when
+// no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		Mode:           ImportModeTruncate,
+		BatchSize:      3,
+		ColumnMode:     ColumnModeStrict,
+		ColumnOrder:    ColumnOrderFile,
+		CSVEmptyAsNull: true,
+		Validate:       true,
+		TimeZone:       time.UTC,
+	}
+}
+
+// Check reports invalid or conflicting options.
+func (options Options) Check() error {
+	if options.Mode != ImportModeTruncate && options.Mode != ImportModeUpsert {
+		return usageErrorf("invalid mode: %s", options.Mode)
+	}
+
+	if options.ColumnMode != ColumnModeStrict && options.ColumnMode != ColumnModeUnion {
+		return usageErrorf("invalid columns mode: %s", options.ColumnMode)
+	}
+
+	if options.ColumnOrder != ColumnOrderFile && options.ColumnOrder != ColumnOrderSorted {
+		return usageErrorf("invalid column order: %s", options.ColumnOrder)
+	}
+
+	if options.Swap && (options.Mode != ImportModeTruncate || options.Atomic) {
+		return usageErrorf("Swap (-swap) can not be combined with Atomic (-atomic) or upsert mode")
+	}
+
+	if options.BatchSize < 0 {
+		return usageErrorf("invalid batch size: %d", options.BatchSize)
+	}
+
+	return nil
+}
+
+// CheckDriver reports options the database driver can not load with.
+// SQLite has no DEFAULT keyword in VALUES, which union mode writes for the
+// columns a row lacks.
+func (options Options) CheckDriver(driver string) error {
+	if driver == DriverSQLite && options.ColumnMode == ColumnModeUnion {
+		return usageErrorf("ColumnMode union (-columns union) is not supported by driver: %s", driver)
+	}
+
+	return nil
+}
+
+// Loader loads the sources selected by its options through an existing
+// connection pool.
+type Loader struct {
+	database *Database
+	options  Options
+}
+
+// NewLoader returns a loader for sqlDB, which must have been opened with
+// driver, one of DriverMySQL, DriverPostgres and DriverSQLite. The loader
+// does not close sqlDB.
+func NewLoader(sqlDB *sql.DB, driver string, options Options) *Loader {
+	return &Loader{
+		database: &Database{
+			Driver:                  driver,
+			DisableForeignKeyChecks: options.DisableForeignKeyChecks,
+			pool:                    sqlDB,
+		},
+		options: options,
+	}
+}
+
+// Load selects the sources and loads them, referenced tables before the
+// tables referencing them.
+func (l *Loader) Load(ctx context.Context) error {
+	options := l.options
+	if options.TimeZone == nil {
+		options.TimeZone = time.UTC
+	}
+	if err := options.Check(); err != nil {
+		return err
+	}
+	if err := options.CheckDriver(l.database.Driver); err != nil {
+		return err
+	}
+
+	if options.BatchSize == 0 && options.MaxQueryBytes == 0 {
+		size, err := l.database.MaxQuerySize(ctx)
+		if err != nil {
+			return err
+		}
+		options.MaxQueryBytes = size - queryByteMargin
+	}
+
+	dataSources, err := SelectDataSources(options)
+	if err != nil {
+		return err
+	}
+
+	return l.load(ctx, dataSources)
+}
+
+// load loads referenced tables before the tables referencing them. In
+// truncate mode with references among dataSources, the tables are loaded
+// as in atomic mode: TRUNCATE is refused on referenced tables, so every
+// table is emptied with DELETE in reverse order and reloaded in a single
+// transaction. Foreign key checks can be disabled instead, which keeps the
+// given order.
+func (l *Loader) load(ctx context.Context, dataSources []*DataSource) error {
+	database := l.database
+	if err := database.DescribeSources(ctx, dataSources); err != nil {
+		return err
+	}
+
+	if l.options.Validate {
+		if err := ValidateSources(dataSources); err != nil {
+			return err
+		}
+	}
+
+	if l.options.Swap {
+		if err := database.CheckSwap(ctx, dataSources); err != nil {
+			return err
+		}
+
+		for _, dataSource := range dataSources {
+			if err := database.LoadWithSwap(ctx, dataSource); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !database.DisableForeignKeyChecks {
+		references, err := database.ForeignKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		sorted, err := SortDataSources(dataSources, references)
+		if err != nil {
+			return validationErrorf("%s\nset DisableForeignKeyChecks (-disable-fk-checks) to load without foreign key checks", err)
+		}
+
+		if !l.options.Atomic && l.options.Mode == ImportModeTruncate && hasReferences(sorted, references) {
+			return database.LoadAtomically(ctx, sorted)
+		}
+
+		dataSources = sorted
+	}
+
+	if l.options.Atomic {
+		return database.LoadAtomically(ctx, dataSources)
+	}
+
+	for _, dataSource := range dataSources {
+		if err := database.LoadWithTransaction(ctx, dataSource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
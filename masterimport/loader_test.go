@@ -0,0 +1,297 @@
+package masterimport
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const loaderSchema = `
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id));
+`
+
+func writeBaseDir(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func openSQLiteFile(t *testing.T) *sql.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open(DriverSQLite, filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if _, err := sqlDB.Exec(loaderSchema); err != nil {
+		t.Fatal(err)
+	}
+	return sqlDB
+}
+
+func queryRows(t *testing.T, sqlDB *sql.DB, query string) [][2]string {
+	t.Helper()
+
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	result := make([][2]string, 0, 0)
+	for rows.Next() {
+		var row [2]string
+		if err := rows.Scan(&row[0], &row[1]); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestLoaderLoad(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := openSQLiteFile(t)
+	baseDir := t.TempDir()
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+
+	writeBaseDir(t, baseDir, map[string]string{
+		"orders.ndjson": "{\"id\": 1, \"user_id\": 2}\n{\"id\": 2, \"user_id\": 1}\n",
+		"users.csv":     "id,name\n1,alice\n2,bob\n",
+	})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wantUsers := [][2]string{{"1", "alice"}, {"2", "bob"}}
+	if got := queryRows(t, sqlDB, "SELECT id, name FROM users ORDER BY id"); !reflect.DeepEqual(got, wantUsers) {
+		t.Errorf("users = %v, want %v", got, wantUsers)
+	}
+	wantOrders := [][2]string{{"1", "2"}, {"2", "1"}}
+	if got := queryRows(t, sqlDB, "SELECT id, user_id FROM orders ORDER BY id"); !reflect.DeepEqual(got, wantOrders) {
+		t.Errorf("orders = %v, want %v", got, wantOrders)
+	}
+
+	// Reloading replaces the rows of both tables.
+	writeBaseDir(t, baseDir, map[string]string{
+		"orders.ndjson": "{\"id\": 3, \"user_id\": 3}\n",
+		"users.csv":     "id,name\n3,carol\n",
+	})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wantUsers = [][2]string{{"3", "carol"}}
+	if got := queryRows(t, sqlDB, "SELECT id, name FROM users ORDER BY id"); !reflect.DeepEqual(got, wantUsers) {
+		t.Errorf("users = %v, want %v", got, wantUsers)
+	}
+
+	// A row violating a foreign key rolls back every table.
+	writeBaseDir(t, baseDir, map[string]string{
+		"orders.ndjson": "{\"id\": 4, \"user_id\": 9}\n",
+		"users.csv":     "id,name\n4,dave\n",
+	})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err == nil {
+		t.Fatal("expected a foreign key error")
+	}
+
+	if got := queryRows(t, sqlDB, "SELECT id, name FROM users ORDER BY id"); !reflect.DeepEqual(got, wantUsers) {
+		t.Errorf("users after rollback = %v, want %v", got, wantUsers)
+	}
+
+	var enabled int
+	if err := sqlDB.QueryRow("PRAGMA foreign_keys").Scan(&enabled); err != nil {
+		t.Fatal(err)
+	}
+	if enabled != 1 {
+		t.Error("foreign key checks were left disabled")
+	}
+}
+
+func TestLoaderLoadHeaderOnly(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := openSQLiteFile(t)
+	baseDir := t.TempDir()
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+
+	writeBaseDir(t, baseDir, map[string]string{"users.csv": "id,name\n1,alice\n"})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A header without rows empties the table.
+	writeBaseDir(t, baseDir, map[string]string{"users.csv": "id,name\n"})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, sqlDB, "SELECT id, name FROM users"); len(got) != 0 {
+		t.Errorf("users = %v, want no rows", got)
+	}
+}
+
+func TestLoaderLoadUpsert(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := openSQLiteFile(t)
+	baseDir := t.TempDir()
+
+	if _, err := sqlDB.Exec(`
+CREATE TABLE updates (id INTEGER);
+CREATE TRIGGER users_update AFTER UPDATE ON users BEGIN INSERT INTO updates VALUES (NEW.id); END;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+	options.Tables = []string{"users"}
+	options.Mode = ImportModeUpsert
+
+	writeBaseDir(t, baseDir, map[string]string{"users.csv": "id,name\n1,alice\n2,bob\n"})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the changed row is updated.
+	writeBaseDir(t, baseDir, map[string]string{"users.csv": "id,name\n1,alice\n2,bobby\n3,carol\n"})
+	if err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wantUsers := [][2]string{{"1", "alice"}, {"2", "bobby"}, {"3", "carol"}}
+	if got := queryRows(t, sqlDB, "SELECT id, name FROM users ORDER BY id"); !reflect.DeepEqual(got, wantUsers) {
+		t.Errorf("users = %v, want %v", got, wantUsers)
+	}
+	wantUpdates := [][2]string{{"2", "2"}}
+	if got := queryRows(t, sqlDB, "SELECT id, id FROM updates"); !reflect.DeepEqual(got, wantUpdates) {
+		t.Errorf("updated = %v, want %v", got, wantUpdates)
+	}
+}
+
+func TestDumpSourcesReferences(t *testing.T) {
+	baseDir := t.TempDir()
+	writeBaseDir(t, baseDir, map[string]string{
+		"orders.ndjson": "{\"id\": 1, \"user_id\": 1}\n",
+		"users.csv":     "id,name\n1,alice\n",
+	})
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+	dataSources, err := SelectDataSources(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	references := map[string][]string{"orders": {"users"}}
+	dataSources, err = SortDataSources(dataSources, references)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &Database{Driver: DriverPostgres}
+	var buf bytes.Buffer
+	if err := db.DumpSources(&buf, dataSources, references); err != nil {
+		t.Fatal(err)
+	}
+
+	// Referenced tables are emptied with DELETE as the loader does.
+	dump := buf.String()
+	deleteOrders := strings.Index(dump, `DELETE FROM "orders"`)
+	deleteUsers := strings.Index(dump, `DELETE FROM "users"`)
+	if strings.Contains(dump, "TRUNCATE") || deleteOrders < 0 || deleteUsers < deleteOrders {
+		t.Errorf("dump with references:\n%s", dump)
+	}
+
+	buf.Reset()
+	if err := db.DumpSources(&buf, dataSources, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dump := buf.String(); strings.Contains(dump, "DELETE FROM") || !strings.Contains(dump, "TRUNCATE") {
+		t.Errorf("dump without references:\n%s", dump)
+	}
+}
+
+func TestWriteScriptErrors(t *testing.T) {
+	swap := DefaultOptions()
+	swap.Swap = true
+	deleteMissing := DefaultOptions()
+	deleteMissing.Mode = ImportModeUpsert
+	deleteMissing.DeleteMissing = true
+
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"swap", swap},
+		{"delete missing", deleteMissing},
+		{"not described", DefaultOptions()},
+	}
+
+	db := &Database{Driver: DriverPostgres}
+	for _, test := range tests {
+		dataSource := &DataSource{TableName: "users", options: test.options}
+		err := db.WriteScript(ioutil.Discard, []*DataSource{dataSource})
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) {
+			t.Errorf("%s: error = %v, want a UsageError", test.name, err)
+		}
+	}
+}
+
+func TestLoaderLoadErrors(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := openSQLiteFile(t)
+
+	baseDir := t.TempDir()
+	writeBaseDir(t, baseDir, map[string]string{
+		"users.csv": "id,name\n1,\n",
+	})
+
+	options := DefaultOptions()
+	options.BaseDir = baseDir
+	err := NewLoader(sqlDB, DriverSQLite, options).Load(ctx)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("error = %v, want a ValidationError", err)
+	}
+
+	options.Swap = true
+	options.Atomic = true
+	err = NewLoader(sqlDB, DriverSQLite, options).Load(ctx)
+	var usageErr *UsageError
+	if !errors.As(err, &usageErr) {
+		t.Errorf("error = %v, want a UsageError", err)
+	}
+
+	options = DefaultOptions()
+	options.BaseDir = baseDir
+	options.ColumnMode = ColumnModeUnion
+	err = NewLoader(sqlDB, DriverSQLite, options).Load(ctx)
+	if !errors.As(err, &usageErr) {
+		t.Errorf("union columns: error = %v, want a UsageError", err)
+	}
+
+	options.ColumnMode = ColumnModeStrict
+	err = NewLoader(sqlDB, "oracle", options).Load(ctx)
+	if !errors.As(err, &usageErr) {
+		t.Errorf("unknown driver: error = %v, want a UsageError", err)
+	}
+}
@@ -0,0 +1,192 @@
+package masterimport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	defaultPostgresPort = "5432"
+)
+
+var postgresValueReplacer = strings.NewReplacer(`\`, `\\`, "'", `\'`)
+
+type PostgresDialect struct{}
+
+func (PostgresDialect) DriverName() string {
+	return DriverPostgres
+}
+
+// DataSourceName returns a keyword/value connection string. Socket is the
+// directory holding the server socket.
+func (PostgresDialect) DataSourceName(db *Database, user string) string {
+	settings := make(map[string]string)
+	for key, value := range db.Params {
+		settings[key] = value
+	}
+
+	if len(db.Socket) > 0 {
+		settings["host"] = db.Socket
+	} else {
+		settings["host"] = db.Host
+		if len(db.Host) == 0 {
+			settings["host"] = defaultHost
+		}
+	}
+	settings["port"] = db.Port
+	if len(db.Port) == 0 {
+		settings["port"] = defaultPostgresPort
+	}
+	settings["dbname"] = db.Name
+	settings["user"] = user
+	if len(db.Password) > 0 {
+		settings["password"] = db.Password
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	elements := make([]string, len(keys))
+	for i, key := range keys {
+		elements[i] = fmt.Sprintf("%s='%s'", key, postgresValueReplacer.Replace(settings[key]))
+	}
+	return strings.Join(elements, " ")
+}
+
+func (PostgresDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteLiteral renders value as a PostgreSQL literal assuming
+// standard_conforming_strings is on.
+func (PostgresDialect) QuoteLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case []byte:
+		return fmt.Sprintf(`'\x%x'::bytea`, v)
+	case time.Time:
+		return "'" + v.Format(time.RFC3339Nano) + "'"
+	}
+	return quoteLiteral(value)
+}
+
+// Rebind converts ? placeholders to $1, $2, ...
+func (PostgresDialect) Rebind(query string) string {
+	var buf strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			buf.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func (dialect PostgresDialect) TruncateQuery(table string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY", dialect.QuoteIdentifier(table))
+}
+
+// UpsertClause updates a conflicting row only when a column differs, so
+// that unchanged rows are not rewritten. Rows are compared as text since
+// types such as json have no equality operator.
+func (dialect PostgresDialect) UpsertClause(table string, columns, keys []string) string {
+	return onConflictClause(dialect, table, columns, keys, "ROW(%s)::text IS DISTINCT FROM ROW(%s)::text")
+}
+
+// onConflictClause returns an ON CONFLICT clause updating every column
+// except keys when the current and the excluded values, joined into the
+// condition format, differ.
+func onConflictClause(dialect Dialect, table string, columns, keys []string, condition string) string {
+	isKey := make(map[string]bool)
+	for _, key := range keys {
+		isKey[key] = true
+	}
+
+	updates := make([]string, 0, len(columns))
+	current := make([]string, 0, len(columns))
+	excluded := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !isKey[column] {
+			quoted := dialect.QuoteIdentifier(column)
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quoted, quoted))
+			current = append(current, dialect.QuoteIdentifier(table)+"."+quoted)
+			excluded = append(excluded, "EXCLUDED."+quoted)
+		}
+	}
+
+	conflict := fmt.Sprintf(" ON CONFLICT (%s)", quoteIdentifiers(dialect, keys))
+	if len(updates) == 0 {
+		return conflict + " DO NOTHING"
+	}
+	return conflict + " DO UPDATE SET " + strings.Join(updates, ", ") +
+		" WHERE " + fmt.Sprintf(condition, strings.Join(current, ", "), strings.Join(excluded, ", "))
+}
+
+func (PostgresDialect) PrimaryKeyQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT kcu.column_name FROM information_schema.table_constraints tc" +
+			" JOIN information_schema.key_column_usage kcu" +
+			" ON tc.constraint_schema = kcu.constraint_schema AND tc.constraint_name = kcu.constraint_name" +
+			" WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = current_schema() AND tc.table_name = $1" +
+			" ORDER BY kcu.ordinal_position",
+		Args: []interface{}{table},
+	}
+}
+
+func (PostgresDialect) ColumnsQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT column_name, is_nullable, column_default IS NOT NULL OR is_identity = 'YES', data_type," +
+			" character_maximum_length, udt_name FROM information_schema.columns" +
+			" WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position",
+		Args: []interface{}{table},
+	}
+}
+
+func (PostgresDialect) TablesQuery() string {
+	return "SELECT table_name FROM information_schema.tables" +
+		" WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name"
+}
+
+func (PostgresDialect) ForeignKeysQuery() string {
+	return "SELECT tc.table_name, ccu.table_name FROM information_schema.table_constraints tc" +
+		" JOIN information_schema.constraint_column_usage ccu" +
+		" ON tc.constraint_schema = ccu.constraint_schema AND tc.constraint_name = ccu.constraint_name" +
+		" WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()"
+}
+
+// ForeignKeyChecksQuery switches the replication role, which skips foreign
+// key triggers. It requires superuser privileges.
+func (PostgresDialect) ForeignKeyChecksQuery(enabled bool) string {
+	if enabled {
+		return "SET session_replication_role = DEFAULT"
+	}
+	return "SET session_replication_role = replica"
+}
+
+func (PostgresDialect) MaxPacketQuery() string {
+	return ""
+}
+
+func (PostgresDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func (PostgresDialect) ScriptHeader() []string {
+	return []string{"SET client_encoding = 'UTF8'", "BEGIN"}
+}
+
+func (PostgresDialect) ScriptFooter() []string {
+	return []string{"COMMIT"}
+}
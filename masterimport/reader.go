@@ -0,0 +1,293 @@
+package masterimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const utf8BOM = "\ufeff"
+
+// readRows returns the rows stored in source with their keys in the order
+// they appear in the file, and the header of CSV and TSV files, which names
+// the columns even when the file holds no rows. JSON files hold a single
+// row object or an array of rows, NDJSON files hold one row per line, YAML
+// files hold a single row and CSV and TSV files hold a whole table.
+func readRows(source string, csvEmptyAsNull bool) ([]string, []sourceRow, error) {
+	var rows []sourceRow
+	var err error
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ymlExt, yamlExt:
+		rows, err = readYAML(source)
+	case ndjsonExt, jsonlExt:
+		rows, err = readNDJSON(source)
+	case csvExt:
+		return readDelimited(source, ',', csvEmptyAsNull)
+	case tsvExt:
+		return readDelimited(source, '\t', csvEmptyAsNull)
+	default:
+		rows, err = readJSON(source)
+	}
+
+	return nil, rows, err
+}
+
+func readYAML(source string) ([]sourceRow, error) {
+	bytes, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	slice := yaml.MapSlice{}
+	if err := yaml.Unmarshal(bytes, &slice); err != nil {
+		return nil, &ParseError{File: source, Err: err}
+	}
+
+	row := sourceRow{
+		Names: make([]string, 0, len(slice)),
+		Data:  make(map[string]interface{}),
+	}
+	for _, item := range slice {
+		name := fmt.Sprint(item.Key)
+		if _, ok := row.Data[name]; !ok {
+			row.Names = append(row.Names, name)
+		}
+		row.Data[name] = normalizeYAMLValue(item.Value)
+	}
+
+	return []sourceRow{row}, nil
+}
+
+// normalizeYAMLValue converts the maps produced by the YAML decoder into
+// the map type encoding/json produces.
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{})
+		for _, item := range v {
+			m[fmt.Sprint(item.Key)] = normalizeYAMLValue(item.Value)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAMLValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = normalizeYAMLValue(item)
+		}
+		return s
+	}
+	return value
+}
+
+// readJSON streams a file whose top level is either a row object or an
+// array of row objects.
+func readJSON(source string) ([]sourceRow, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return nil, &ParseError{File: source, Err: err}
+	}
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	if first != '[' {
+		row, err := decodeRow(decoder)
+		if err != nil {
+			return nil, &ParseError{File: source, Err: err}
+		}
+		return []sourceRow{row}, nil
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, &ParseError{File: source, Err: err}
+	}
+
+	rows := make([]sourceRow, 0, 0)
+	for decoder.More() {
+		row, err := decodeRow(decoder)
+		if err != nil {
+			return nil, &ParseError{File: source, Row: len(rows) + 1, Err: err}
+		}
+		rows = append(rows, row)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, &ParseError{File: source, Err: err}
+	}
+
+	return rows, nil
+}
+
+// readNDJSON reads one row object per line. Blank lines are skipped.
+func readNDJSON(source string) ([]sourceRow, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	rows := make([]sourceRow, 0, 0)
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, &ParseError{File: source, Line: line, Err: err}
+		}
+
+		if len(bytes.TrimSpace(b)) > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(b))
+			decoder.UseNumber()
+			row, err := decodeRow(decoder)
+			if err != nil {
+				return nil, &ParseError{File: source, Line: line, Err: err}
+			}
+			rows = append(rows, row)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+// decodeRow decodes the next JSON object from decoder keeping key order.
+func decodeRow(decoder *json.Decoder) (sourceRow, error) {
+	row := sourceRow{
+		Names: make([]string, 0, 0),
+		Data:  make(map[string]interface{}),
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return row, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return row, fmt.Errorf("expected object but got %v", token)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return row, err
+		}
+		name := token.(string)
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return row, err
+		}
+
+		if _, ok := row.Data[name]; !ok {
+			row.Names = append(row.Names, name)
+		}
+		row.Data[name] = value
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return row, err
+	}
+
+	return row, nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return b, reader.UnreadByte()
+	}
+}
+
+// readDelimited reads a table file whose first record is the header row
+// and returns the header with the rows. Empty cells become NULL unless
+// csvEmptyAsNull is false.
+func readDelimited(source string, comma rune, csvEmptyAsNull bool) ([]string, []sourceRow, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = comma
+	if comma == '\t' {
+		reader.LazyQuotes = true
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, &ParseError{File: source, Err: errors.New("header row not found")}
+	}
+	if err != nil {
+		return nil, nil, &ParseError{File: source, Err: err}
+	}
+	header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	columns := make(map[string]int)
+	for i, name := range header {
+		if len(name) == 0 {
+			return nil, nil, &ParseError{File: source, Err: fmt.Errorf("empty column name at column %d", i+1)}
+		}
+		if j, ok := columns[name]; ok {
+			return nil, nil, &ParseError{File: source, Err: fmt.Errorf("duplicate column name %s at columns %d and %d", name, j+1, i+1)}
+		}
+		columns[name] = i
+	}
+
+	rows := make([]sourceRow, 0, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, &ParseError{File: source, Err: err}
+		}
+
+		row := sourceRow{
+			Names: header,
+			Data:  make(map[string]interface{}),
+			Text:  true,
+		}
+		for i, name := range header {
+			if len(record[i]) == 0 && csvEmptyAsNull {
+				row.Data[name] = nil
+			} else {
+				row.Data[name] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return header, rows, nil
+}
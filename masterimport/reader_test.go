@@ -0,0 +1,196 @@
+package masterimport
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFile writes content to name under a new directory and returns its
+// path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadDelimited(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		comma       rune
+		emptyAsNull bool
+		names       []string
+		rows        []map[string]interface{}
+	}{
+		{
+			name:        "BOM",
+			content:     utf8BOM + "id,name\n1,a\n",
+			comma:       ',',
+			emptyAsNull: true,
+			names:       []string{"id", "name"},
+			rows:        []map[string]interface{}{{"id": "1", "name": "a"}},
+		},
+		{
+			name:        "quoting",
+			content:     "id,name\n1,\"a,\"\"b\"\"\"\n2,\"line\nbreak\"\n",
+			comma:       ',',
+			emptyAsNull: true,
+			names:       []string{"id", "name"},
+			rows: []map[string]interface{}{
+				{"id": "1", "name": `a,"b"`},
+				{"id": "2", "name": "line\nbreak"},
+			},
+		},
+		{
+			name:        "empty cells as NULL",
+			content:     "id,name\n1,\n",
+			comma:       ',',
+			emptyAsNull: true,
+			names:       []string{"id", "name"},
+			rows:        []map[string]interface{}{{"id": "1", "name": nil}},
+		},
+		{
+			name:        "empty cells as empty strings",
+			content:     "id,name\n1,\n",
+			comma:       ',',
+			emptyAsNull: false,
+			names:       []string{"id", "name"},
+			rows:        []map[string]interface{}{{"id": "1", "name": ""}},
+		},
+		{
+			name:        "TSV with bare quotes",
+			content:     "id\tname\n1\ta\"b\n",
+			comma:       '\t',
+			emptyAsNull: true,
+			names:       []string{"id", "name"},
+			rows:        []map[string]interface{}{{"id": "1", "name": `a"b`}},
+		},
+		{
+			name:        "header only",
+			content:     "id,name\n",
+			comma:       ',',
+			emptyAsNull: true,
+			names:       []string{"id", "name"},
+			rows:        []map[string]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		header, rows, err := readDelimited(writeFile(t, "t.csv", test.content), test.comma, test.emptyAsNull)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(header, test.names) {
+			t.Errorf("%s: header = %q, want %q", test.name, header, test.names)
+		}
+
+		data := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			data[i] = row.Data
+			if !reflect.DeepEqual(row.Names, test.names) {
+				t.Errorf("%s: names = %q, want %q", test.name, row.Names, test.names)
+			}
+		}
+		if !reflect.DeepEqual(data, test.rows) {
+			t.Errorf("%s: rows = %v, want %v", test.name, data, test.rows)
+		}
+	}
+}
+
+func TestReadDelimitedErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty file", ""},
+		{"empty column name", "id,\n1,a\n"},
+		{"duplicate column name", "id,name,id\n1,a,2\n"},
+		{"missing cell", "id,name\n1\n"},
+		{"unterminated quote", "id,name\n1,\"a\n"},
+	}
+
+	for _, test := range tests {
+		_, _, err := readDelimited(writeFile(t, "t.csv", test.content), ',', true)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: error = %v, want a ParseError", test.name, err)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		rows    int
+		errRow  int
+	}{
+		{"object", `{"id": 1, "name": "a"}`, 1, 0},
+		{"array", `[{"id": 1}, {"id": 2}]`, 2, 0},
+		{"empty array", `[]`, 0, 0},
+		{"empty file", ``, 0, -1},
+		{"invalid row", `[{"id": 1}, {"id": }]`, 0, 2},
+		{"non-object row", `[{"id": 1}, {"id": 2}, 3]`, 0, 3},
+		{"unterminated array", `[{"id": 1}`, 0, -1},
+	}
+
+	for _, test := range tests {
+		rows, err := readJSON(writeFile(t, "t.json", test.content))
+		if test.errRow == 0 {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			} else if len(rows) != test.rows {
+				t.Errorf("%s: got %d rows, want %d", test.name, len(rows), test.rows)
+			}
+			continue
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: error = %v, want a ParseError", test.name, err)
+		} else if test.errRow > 0 && parseErr.Row != test.errRow {
+			t.Errorf("%s: error row = %d, want %d", test.name, parseErr.Row, test.errRow)
+		}
+	}
+}
+
+func TestReadNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		rows    int
+		errLine int
+	}{
+		{"rows", "{\"id\": 1}\n{\"id\": 2}\n", 2, 0},
+		{"blank lines", "\n{\"id\": 1}\n\n  \n{\"id\": 2}", 2, 0},
+		{"invalid line", "{\"id\": 1}\n\n{\"id\":\n", 0, 3},
+		{"non-object line", "{\"id\": 1}\n[1]\n", 0, 2},
+	}
+
+	for _, test := range tests {
+		rows, err := readNDJSON(writeFile(t, "t.ndjson", test.content))
+		if test.errLine == 0 {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			} else if len(rows) != test.rows {
+				t.Errorf("%s: got %d rows, want %d", test.name, len(rows), test.rows)
+			}
+			continue
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: error = %v, want a ParseError", test.name, err)
+		} else if parseErr.Line != test.errLine {
+			t.Errorf("%s: error line = %d, want %d", test.name, parseErr.Line, test.errLine)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package masterimport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Column describes a column of a target table as reported by the dialect's
+// ColumnsQuery.
+type Column struct {
+	Name       string
+	Nullable   bool
+	HasDefault bool
+	DataType   string
+	MaxLength  sql.NullInt64
+	ColumnType string
+}
+
+var enumPattern = regexp.MustCompile(`^(?i)(enum|set)\((.*)\)$`)
+
+var integerRanges = map[string][2]float64{
+	"tinyint":   {math.MinInt8, math.MaxInt8},
+	"smallint":  {math.MinInt16, math.MaxInt16},
+	"mediumint": {-1 << 23, 1<<23 - 1},
+	"int":       {math.MinInt32, math.MaxInt32},
+	"integer":   {math.MinInt32, math.MaxInt32},
+	"bigint":    {math.MinInt64, math.MaxInt64},
+}
+
+func (db *Database) tableColumns(ctx context.Context, sqlDB queryer, dialect Dialect, table string) ([]Column, error) {
+	query := dialect.ColumnsQuery(table)
+	rows, err := sqlDB.QueryContext(ctx, query.Query, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]Column, 0, 0)
+	for rows.Next() {
+		var column Column
+		var nullable string
+		err := rows.Scan(&column.Name, &nullable, &column.HasDefault,
+			&column.DataType, &column.MaxLength, &column.ColumnType)
+		if err != nil {
+			return nil, err
+		}
+		column.Nullable = strings.ToUpper(nullable) == "YES"
+		column.DataType = strings.ToLower(column.DataType)
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// ValidateSources checks every data source against the columns of its
+// target table, as read by DescribeSources, before anything is written and
+// reports every problem found with the location and key of the offending
+// row.
+func ValidateSources(dataSources []*DataSource) error {
+	reports := make([]string, 0, 0)
+	for _, dataSource := range dataSources {
+		if len(dataSource.columns) == 0 {
+			reports = append(reports, fmt.Sprintf("Table not found: %s", dataSource.TableName))
+			continue
+		}
+
+		problems, err := validateDataSource(dataSource)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			reports = append(reports, fmt.Sprintf("Schema mismatch in %s:\n%s", dataSource.TableName, strings.Join(problems, "\n")))
+		}
+	}
+
+	if len(reports) > 0 {
+		return validationErrorf("%s", strings.Join(reports, "\n"))
+	}
+	return nil
+}
+
+func validateDataSource(dataSource *DataSource) ([]string, error) {
+	rows, err := dataSource.sourceRows()
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := dataSource.ColumnNames()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]string, 0, 0)
+	byName := make(map[string]Column)
+	for _, column := range dataSource.columns {
+		byName[column.Name] = column
+	}
+
+	provided := make(map[string]bool)
+	for i := 0; i < len(names); i++ {
+		provided[names[i]] = true
+		if _, ok := byName[names[i]]; !ok {
+			problems = append(problems, fmt.Sprintf("  %s: unknown column %s", dataSource.Source, names[i]))
+		}
+	}
+
+	for _, column := range dataSource.columns {
+		if len(rows) > 0 && !column.Nullable && !column.HasDefault && !provided[column.Name] {
+			problems = append(problems, fmt.Sprintf("  %s: missing NOT NULL column %s", dataSource.Source, column.Name))
+		}
+	}
+
+	for _, row := range rows {
+		location := row.Location
+		if key := rowKey(row, dataSource.tableKeys); len(key) > 0 {
+			location = fmt.Sprintf("%s (%s)", location, key)
+		}
+
+		for i := 0; i < len(names); i++ {
+			column, ok := byName[names[i]]
+			if !ok {
+				continue
+			}
+
+			value, ok := row.Data[names[i]]
+			if !ok {
+				if !column.Nullable && !column.HasDefault {
+					problems = append(problems, fmt.Sprintf("  %s: missing NOT NULL column %s", location, column.Name))
+				}
+				continue
+			}
+
+			value, err := coerceValue(column, value, row.Text, dataSource.options.TimeZone)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("  %s: %s %s", location, column.Name, err))
+				continue
+			}
+
+			if problem := checkValue(column, value); len(problem) > 0 {
+				problems = append(problems, fmt.Sprintf("  %s: %s %s", location, column.Name, problem))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// rowKey formats the primary key of a row, or returns an empty string when
+// the row does not carry every key column.
+func rowKey(row sourceRow, keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, ok := row.Data[key]
+		if !ok {
+			return ""
+		}
+		values[i] = value
+	}
+	return formatKey(keys, values)
+}
+
+// checkValue returns a description of why value does not fit column, or an
+// empty string when it does.
+func checkValue(column Column, value interface{}) string {
+	if value == nil {
+		if !column.Nullable {
+			return "is NULL but the column is NOT NULL"
+		}
+		return ""
+	}
+
+	if matches := enumPattern.FindStringSubmatch(column.ColumnType); matches != nil {
+		return checkEnumValue(strings.ToLower(matches[1]), enumValues(matches[2]), value)
+	}
+
+	if limits, ok := integerRanges[column.DataType]; ok {
+		return checkIntegerValue(column, limits, value)
+	}
+
+	switch column.DataType {
+	case "decimal", "numeric", "float", "double", "real", "double precision":
+		if _, ok := numericValue(value); !ok {
+			return fmt.Sprintf("value %s is not a number", quoteLiteral(value))
+		}
+	}
+
+	if column.MaxLength.Valid {
+		if text, ok := value.(string); ok {
+			if length := utf8.RuneCountInString(text); int64(length) > column.MaxLength.Int64 {
+				return fmt.Sprintf("value is %d characters, longer than %d", length, column.MaxLength.Int64)
+			}
+		}
+	}
+
+	return ""
+}
+
+func checkIntegerValue(column Column, limits [2]float64, value interface{}) string {
+	if _, ok := value.(bool); ok {
+		return ""
+	}
+
+	number, ok := numericValue(value)
+	if !ok || number != math.Trunc(number) {
+		return fmt.Sprintf("value %s is not an integer", quoteLiteral(value))
+	}
+
+	min, max := limits[0], limits[1]
+	unsigned := strings.Contains(strings.ToLower(column.ColumnType), "unsigned")
+	if unsigned {
+		min, max = 0, max*2+1
+	}
+
+	// float64 can not tell the bounds of BIGINT apart, so exact numbers
+	// are parsed as integers instead.
+	if n, ok := value.(json.Number); ok && column.DataType == "bigint" {
+		var err error
+		if unsigned {
+			_, err = strconv.ParseUint(string(n), 10, 64)
+		} else {
+			_, err = strconv.ParseInt(string(n), 10, 64)
+		}
+		if err != nil {
+			return fmt.Sprintf("value %s is out of range for %s", quoteLiteral(value), column.ColumnType)
+		}
+		return ""
+	}
+
+	if number < min || number > max {
+		return fmt.Sprintf("value %s is out of range for %s", quoteLiteral(value), column.ColumnType)
+	}
+
+	return ""
+}
+
+func checkEnumValue(kind string, allowed map[string]bool, value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Sprintf("value %s is not a string", quoteLiteral(value))
+	}
+
+	elements := []string{text}
+	if kind == "set" {
+		elements = strings.Split(text, ",")
+		if len(text) == 0 {
+			elements = nil
+		}
+	}
+
+	for _, element := range elements {
+		if !allowed[element] {
+			return fmt.Sprintf("value %s is not in %s", quoteLiteral(element), kind)
+		}
+	}
+
+	return ""
+}
+
+// enumValues parses the quoted member list of an ENUM or SET column type.
+func enumValues(list string) map[string]bool {
+	values := make(map[string]bool)
+	var current []rune
+	quoted := false
+	runes := []rune(list)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\'' && quoted && i+1 < len(runes) && runes[i+1] == '\'':
+			current = append(current, '\'')
+			i++
+		case runes[i] == '\'':
+			if quoted {
+				values[string(current)] = true
+				current = current[:0]
+			}
+			quoted = !quoted
+		case quoted:
+			current = append(current, runes[i])
+		}
+	}
+	return values
+}
+
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package masterimport
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnumValues(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{`'a','b'`, []string{"a", "b"}},
+		{`'it''s','x,y'`, []string{"it's", "x,y"}},
+		{`'','🍣'`, []string{"", "🍣"}},
+	}
+
+	for _, test := range tests {
+		want := make(map[string]bool)
+		for _, value := range test.want {
+			want[value] = true
+		}
+		if got := enumValues(test.list); !reflect.DeepEqual(got, want) {
+			t.Errorf("enumValues(%s) = %v, want %v", test.list, got, want)
+		}
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	nullable := Column{Name: "c", Nullable: true, DataType: "varchar", ColumnType: "varchar(3)", MaxLength: sql.NullInt64{Int64: 3, Valid: true}}
+	tinyint := Column{Name: "c", DataType: "tinyint", ColumnType: "tinyint(4)"}
+	unsigned := Column{Name: "c", DataType: "tinyint", ColumnType: "tinyint(3) unsigned"}
+	bigint := Column{Name: "c", DataType: "bigint", ColumnType: "bigint(20)"}
+	decimal := Column{Name: "c", DataType: "decimal", ColumnType: "decimal(10,2)"}
+	enum := Column{Name: "c", DataType: "enum", ColumnType: "enum('a','it''s')"}
+	set := Column{Name: "c", DataType: "set", ColumnType: "set('a','b')"}
+
+	tests := []struct {
+		column Column
+		value  interface{}
+		want   string
+	}{
+		{nullable, nil, ""},
+		{tinyint, nil, "NOT NULL"},
+		{nullable, "🍣🍣🍣", ""},
+		{nullable, "abcd", "longer than 3"},
+		{tinyint, json.Number("127"), ""},
+		{tinyint, json.Number("128"), "out of range"},
+		{tinyint, "-128", ""},
+		{tinyint, 1.5, "not an integer"},
+		{tinyint, true, ""},
+		{unsigned, json.Number("255"), ""},
+		{unsigned, json.Number("-1"), "out of range"},
+		{bigint, json.Number("9223372036854775807"), ""},
+		{bigint, json.Number("9223372036854775808"), "out of range"},
+		{decimal, "12.50", ""},
+		{decimal, "abc", "not a number"},
+		{enum, "it's", ""},
+		{enum, "b", "not in enum"},
+		{set, "a,b", ""},
+		{set, "", ""},
+		{set, "a,c", "not in set"},
+	}
+
+	for _, test := range tests {
+		got := checkValue(test.column, test.value)
+		if (test.want == "") != (got == "") || !strings.Contains(got, test.want) {
+			t.Errorf("checkValue(%s, %#v) = %q, want %q", test.column.ColumnType, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package masterimport
+
+import (
+	"fmt"
+)
+
+const (
+	DriverSQLite = "sqlite3"
+)
+
+// SQLiteDialect targets a local database file given as the database name.
+// The driver needs cgo and is not registered by this package; programs
+// import github.com/mattn/go-sqlite3 to use it.
+type SQLiteDialect struct {
+	PostgresDialect
+}
+
+func (SQLiteDialect) DriverName() string {
+	return DriverSQLite
+}
+
+func (SQLiteDialect) DataSourceName(db *Database, user string) string {
+	return db.Name + db.dsnOptions()
+}
+
+// QuoteLiteral renders booleans as integers since SQLite stores them as 0
+// and 1, and binary values as blob literals.
+func (dialect SQLiteDialect) QuoteLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return fmt.Sprintf("X'%x'", v)
+	}
+	return dialect.PostgresDialect.QuoteLiteral(value)
+}
+
+func (SQLiteDialect) Rebind(query string) string {
+	return query
+}
+
+func (dialect SQLiteDialect) TruncateQuery(table string) string {
+	return fmt.Sprintf("DELETE FROM %s", dialect.QuoteIdentifier(table))
+}
+
+// UpsertClause updates a conflicting row only when a column differs,
+// comparing the row values with IS NOT, which treats NULLs as equal.
+func (dialect SQLiteDialect) UpsertClause(table string, columns, keys []string) string {
+	return onConflictClause(dialect, table, columns, keys, "(%s) IS NOT (%s)")
+}
+
+func (SQLiteDialect) PrimaryKeyQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk",
+		Args:  []interface{}{table},
+	}
+}
+
+func (SQLiteDialect) ColumnsQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT name, CASE WHEN \"notnull\" = 0 THEN 'YES' ELSE 'NO' END," +
+			" dflt_value IS NOT NULL OR (pk = 1 AND upper(type) = 'INTEGER')," +
+			" CASE WHEN upper(type) LIKE '%INT%' THEN 'bigint' ELSE type END, NULL, type" +
+			" FROM pragma_table_info(?) ORDER BY cid",
+		Args: []interface{}{table},
+	}
+}
+
+func (SQLiteDialect) TablesQuery() string {
+	return "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+}
+
+func (SQLiteDialect) ForeignKeysQuery() string {
+	return "SELECT m.name, p.\"table\" FROM sqlite_master m" +
+		" JOIN pragma_foreign_key_list(m.name) p WHERE m.type = 'table'"
+}
+
+// ForeignKeyChecksQuery toggles foreign key enforcement. SQLite ignores it
+// inside a transaction, so it is executed on the connection before the
+// transaction starts. Enforcement is off unless enabled in the DSN.
+func (SQLiteDialect) ForeignKeyChecksQuery(enabled bool) string {
+	if enabled {
+		return "PRAGMA foreign_keys = ON"
+	}
+	return "PRAGMA foreign_keys = OFF"
+}
+
+// SequenceTableQuery reports whether sqlite_sequence exists. SQLite creates
+// it along with the first AUTOINCREMENT table.
+func (SQLiteDialect) SequenceTableQuery() string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'"
+}
+
+func (SQLiteDialect) ResetSequenceQuery(table string) Statement {
+	return Statement{
+		Query: "DELETE FROM sqlite_sequence WHERE name = ?",
+		Args:  []interface{}{table},
+	}
+}
+
+// MaxPlaceholders returns SQLITE_MAX_VARIABLE_NUMBER of SQLite 3.32.0 and
+// later.
+func (SQLiteDialect) MaxPlaceholders() int {
+	return 32766
+}
+
+func (dialect SQLiteDialect) ScriptHeader() []string {
+	return []string{dialect.ForeignKeyChecksQuery(false), "BEGIN TRANSACTION"}
+}
+
+func (dialect SQLiteDialect) ScriptFooter() []string {
+	return []string{"COMMIT", dialect.ForeignKeyChecksQuery(true)}
+}
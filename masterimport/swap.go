@@ -0,0 +1,248 @@
+package masterimport
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const (
+	shadowTableSuffix = "_new"
+	oldTableSuffix    = "_old"
+)
+
+// TableSwapper is implemented by dialects that can load rows into a shadow
+// table and swap it with the live table in a single statement.
+type TableSwapper interface {
+	CreateTableLikeQuery(table, like string) string
+	DropTableQuery(table string) string
+	SwapTablesQuery(table, shadow, old string) string
+	TriggersQuery(table string) Statement
+}
+
+func (dialect MySQLDialect) CreateTableLikeQuery(table, like string) string {
+	return fmt.Sprintf("CREATE TABLE %s LIKE %s", dialect.QuoteIdentifier(table), dialect.QuoteIdentifier(like))
+}
+
+func (dialect MySQLDialect) DropTableQuery(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", dialect.QuoteIdentifier(table))
+}
+
+func (dialect MySQLDialect) SwapTablesQuery(table, shadow, old string) string {
+	return fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s",
+		dialect.QuoteIdentifier(table), dialect.QuoteIdentifier(old),
+		dialect.QuoteIdentifier(shadow), dialect.QuoteIdentifier(table))
+}
+
+// TriggersQuery counts the triggers of table, which RENAME TABLE leaves on
+// the old table.
+func (MySQLDialect) TriggersQuery(table string) Statement {
+	return Statement{
+		Query: "SELECT COUNT(*) FROM information_schema.TRIGGERS" +
+			" WHERE EVENT_OBJECT_SCHEMA = DATABASE() AND EVENT_OBJECT_TABLE = ?",
+		Args: []interface{}{table},
+	}
+}
+
+func (builder QueryBuilder) CountQuery() string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s", builder.table())
+}
+
+// shadowDataSource returns a copy of the data source that targets the
+// shadow table of the same rows.
+func shadowDataSource(dataSource *DataSource) (*DataSource, error) {
+	if _, err := dataSource.StringValues(); err != nil {
+		return nil, err
+	}
+
+	shadow := *dataSource
+	shadow.TableName = dataSource.TableName + shadowTableSuffix
+	return &shadow, nil
+}
+
+func (db *Database) tableSwapper(dialect Dialect) (TableSwapper, error) {
+	swapper, ok := dialect.(TableSwapper)
+	if !ok {
+		return nil, usageErrorf("Table swap is not supported by driver: %s", db.Driver)
+	}
+	return swapper, nil
+}
+
+// CheckSwap reports tables of dataSources that can not be swapped without
+// losing schema objects. CREATE TABLE ... LIKE copies neither foreign keys
+// nor triggers, RENAME TABLE leaves triggers on the old table, and foreign
+// keys of other tables follow the renamed table.
+func (db *Database) CheckSwap(ctx context.Context, dataSources []*DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	swapper, err := db.tableSwapper(dialect)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	references, err := db.foreignKeys(ctx, sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+
+	for _, dataSource := range dataSources {
+		table := dataSource.TableName
+		if len(references[table]) > 0 {
+			return usageErrorf("Table swap would drop the foreign keys of %s", table)
+		}
+		for referencing, referenced := range references {
+			for _, name := range referenced {
+				if name == table && referencing != table {
+					return usageErrorf("Table swap would leave the foreign keys of %s on %s%s", referencing, table, oldTableSuffix)
+				}
+			}
+		}
+
+		var count int
+		query := swapper.TriggersQuery(table)
+		if err := sqlDB.QueryRowContext(ctx, query.Query, query.Args...).Scan(&count); err != nil {
+			return sqlError(table, 0, err)
+		}
+		if count > 0 {
+			return usageErrorf("Table swap would drop the triggers of %s", table)
+		}
+	}
+
+	return nil
+}
+
+// LoadWithSwap loads rows into a shadow table created like the live table,
+// verifies the row count and renames the shadow table over the live one,
+// so readers never see an empty table. The previous table is dropped
+// unless KeepOld is set. Tables refused by CheckSwap are not loaded.
+func (db *Database) LoadWithSwap(ctx context.Context, dataSource *DataSource) error {
+	dialect, err := db.Dialect()
+	if err != nil {
+		return err
+	}
+
+	swapper, err := db.tableSwapper(dialect)
+	if err != nil {
+		return err
+	}
+
+	if err := db.CheckSwap(ctx, []*DataSource{dataSource}); err != nil {
+		return err
+	}
+
+	shadow, err := shadowDataSource(dataSource)
+	if err != nil {
+		return err
+	}
+	oldTable := dataSource.TableName + oldTableSuffix
+
+	sqlDB, err := db.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.release(sqlDB)
+
+	prepareQueries := []string{
+		swapper.DropTableQuery(shadow.TableName),
+		swapper.CreateTableLikeQuery(shadow.TableName, dataSource.TableName),
+	}
+	for _, query := range prepareQueries {
+		if _, err := sqlDB.ExecContext(ctx, query); err != nil {
+			return sqlError(shadow.TableName, 0, err)
+		}
+	}
+
+	queryBuilder := NewQueryBuilder(shadow, dialect)
+	if err := db.loadShadow(ctx, sqlDB, dialect, queryBuilder); err != nil {
+		sqlDB.ExecContext(ctx, swapper.DropTableQuery(shadow.TableName))
+		return err
+	}
+
+	var count int
+	if err := sqlDB.QueryRowContext(ctx, queryBuilder.CountQuery()).Scan(&count); err != nil {
+		return sqlError(shadow.TableName, 0, err)
+	}
+	if count != len(shadow.stringValues) {
+		sqlDB.ExecContext(ctx, swapper.DropTableQuery(shadow.TableName))
+		return &SQLError{
+			Table: shadow.TableName,
+			Err:   fmt.Errorf("row count mismatch: %d loaded, %d in source", count, len(shadow.stringValues)),
+		}
+	}
+
+	swapQueries := []string{
+		swapper.DropTableQuery(oldTable),
+		swapper.SwapTablesQuery(dataSource.TableName, shadow.TableName, oldTable),
+	}
+	if !dataSource.options.KeepOld {
+		swapQueries = append(swapQueries, swapper.DropTableQuery(oldTable))
+	}
+	for _, query := range swapQueries {
+		if _, err := sqlDB.ExecContext(ctx, query); err != nil {
+			return sqlError(dataSource.TableName, 0, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) loadShadow(ctx context.Context, sqlDB *sql.DB, dialect Dialect, queryBuilder QueryBuilder) error {
+	tx, end, err := db.begin(ctx, sqlDB, dialect)
+	if err != nil {
+		return sqlError(queryBuilder.dataSource.TableName, 0, err)
+	}
+	defer end()
+
+	if err := db.insertRows(ctx, tx, queryBuilder); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return sqlError(queryBuilder.dataSource.TableName, 0, tx.Commit())
+}
+
+// swapStatements returns the statements LoadWithSwap executes for a data
+// source, except for the row count check.
+func (db *Database) swapStatements(dialect Dialect, dataSource *DataSource) ([]Statement, error) {
+	swapper, err := db.tableSwapper(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	shadow, err := shadowDataSource(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	oldTable := dataSource.TableName + oldTableSuffix
+
+	insertQueries, err := NewQueryBuilder(shadow, dialect).InsertQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []Statement{
+		{Query: swapper.DropTableQuery(shadow.TableName)},
+		{Query: swapper.CreateTableLikeQuery(shadow.TableName, dataSource.TableName)},
+	}
+	for i := 0; i < len(insertQueries); i++ {
+		statements = append(statements, insertQueries[i])
+	}
+	statements = append(statements,
+		Statement{Query: swapper.DropTableQuery(oldTable)},
+		Statement{Query: swapper.SwapTablesQuery(dataSource.TableName, shadow.TableName, oldTable)},
+	)
+	if !dataSource.options.KeepOld {
+		statements = append(statements, Statement{Query: swapper.DropTableQuery(oldTable)})
+	}
+
+	return statements, nil
+}
@@ -0,0 +1,62 @@
+package masterimport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSwapStatements(t *testing.T) {
+	db := &Database{Driver: DriverMySQL}
+
+	tests := []struct {
+		keepOld bool
+		want    []string
+	}{
+		{false, []string{
+			"DROP TABLE IF EXISTS `items_new`",
+			"CREATE TABLE `items_new` LIKE `items`",
+			"",
+			"DROP TABLE IF EXISTS `items_old`",
+			"RENAME TABLE `items` TO `items_old`, `items_new` TO `items`",
+			"DROP TABLE IF EXISTS `items_old`",
+		}},
+		{true, []string{
+			"DROP TABLE IF EXISTS `items_new`",
+			"CREATE TABLE `items_new` LIKE `items`",
+			"",
+			"DROP TABLE IF EXISTS `items_old`",
+			"RENAME TABLE `items` TO `items_old`, `items_new` TO `items`",
+		}},
+	}
+
+	for _, test := range tests {
+		options := DefaultOptions()
+		options.KeepOld = test.keepOld
+		dataSource, err := NewDataSource(writeFile(t, "items.csv", "id,name\n1,a\n"), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		statements, err := db.swapStatements(MySQLDialect{}, dataSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, len(statements))
+		for i, statement := range statements {
+			if len(statement.Args) == 0 {
+				got[i] = statement.Query
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("keepOld %v: statements = %q, want %q", test.keepOld, got, test.want)
+		}
+	}
+}
+
+func TestSwapUnsupported(t *testing.T) {
+	db := &Database{Driver: DriverPostgres}
+	if _, err := db.swapStatements(PostgresDialect{}, &DataSource{}); err == nil {
+		t.Error("swap succeeded with a driver without table swap")
+	}
+}
@@ -0,0 +1,180 @@
+package masterimport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes, named after the --ssl-mode option of the mysql client.
+const (
+	SSLModeDisabled       = "DISABLED"
+	SSLModePreferred      = "PREFERRED"
+	SSLModeRequired       = "REQUIRED"
+	SSLModeVerifyCA       = "VERIFY_CA"
+	SSLModeVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+const tlsConfigName = AppName
+
+var postgresSSLModes = map[string]string{
+	SSLModeDisabled:       "disable",
+	SSLModePreferred:      "prefer",
+	SSLModeRequired:       "require",
+	SSLModeVerifyCA:       "verify-ca",
+	SSLModeVerifyIdentity: "verify-full",
+}
+
+// TLSConfigurer is implemented by dialects that can connect over TLS.
+type TLSConfigurer interface {
+	ConfigureTLS(db *Database, mode string) error
+}
+
+// sslMode returns the SSL mode of the database, defaulting to VERIFY_CA
+// when a CA is given and to REQUIRED when only a client certificate is.
+// It returns an empty string when no SSL option is set.
+func (db *Database) sslMode() (string, error) {
+	mode := strings.ToUpper(db.SSLMode)
+	switch mode {
+	case SSLModeDisabled, SSLModePreferred, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+		return mode, nil
+	case "":
+	default:
+		return "", usageErrorf("Invalid SSL mode: %s", db.SSLMode)
+	}
+
+	if len(db.SSLCA) > 0 {
+		return SSLModeVerifyCA, nil
+	}
+	if len(db.SSLCert)+len(db.SSLKey) > 0 {
+		return SSLModeRequired, nil
+	}
+	return "", nil
+}
+
+// configureTLS applies the SSL options to the connection parameters.
+func (db *Database) configureTLS(dialect Dialect) error {
+	mode, err := db.sslMode()
+	if err != nil || len(mode) == 0 {
+		return err
+	}
+
+	configurer, ok := dialect.(TLSConfigurer)
+	if !ok {
+		return usageErrorf("SSL options are not supported by driver: %s", db.Driver)
+	}
+	return configurer.ConfigureTLS(db, mode)
+}
+
+// SetParam sets a DSN parameter, overriding any previous value.
+func (db *Database) SetParam(key, value string) {
+	if db.Params == nil {
+		db.Params = make(map[string]string)
+	}
+	db.Params[key] = value
+}
+
+// ConfigureTLS registers a tls.Config with the mysql driver and selects it
+// with the tls parameter. PREFERRED behaves like REQUIRED, since the driver
+// can not fall back to a plain connection.
+func (MySQLDialect) ConfigureTLS(db *Database, mode string) error {
+	if mode == SSLModeDisabled {
+		db.SetParam("tls", "false")
+		return nil
+	}
+
+	config := &tls.Config{}
+	if len(db.SSLCA) > 0 {
+		pem, err := ioutil.ReadFile(db.SSLCA)
+		if err != nil {
+			return err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No certificates found in %s", db.SSLCA)
+		}
+	}
+
+	if len(db.SSLCert)+len(db.SSLKey) > 0 {
+		cert, err := tls.LoadX509KeyPair(db.SSLCert, db.SSLKey)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case SSLModePreferred, SSLModeRequired:
+		config.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+	case SSLModeVerifyIdentity:
+		config.ServerName = db.Host
+		if len(db.Host) == 0 {
+			config.ServerName = defaultHost
+		}
+	}
+
+	if err := mysql.RegisterTLSConfig(tlsConfigName, config); err != nil {
+		return err
+	}
+	db.SetParam("tls", tlsConfigName)
+	return nil
+}
+
+// verifyChain returns a verification function that checks the certificate
+// chain of the server against roots without checking its host name.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		if len(certs) == 0 {
+			return fmt.Errorf("Server sent no certificate")
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+// ConfigureTLS sets the sslmode, sslrootcert, sslcert and sslkey
+// parameters of lib/pq.
+func (PostgresDialect) ConfigureTLS(db *Database, mode string) error {
+	db.SetParam("sslmode", postgresSSLModes[mode])
+
+	files := map[string]string{
+		"sslrootcert": db.SSLCA,
+		"sslcert":     db.SSLCert,
+		"sslkey":      db.SSLKey,
+	}
+	for key, path := range files {
+		if len(path) > 0 {
+			db.SetParam(key, path)
+		}
+	}
+	return nil
+}
+
+func (SQLiteDialect) ConfigureTLS(db *Database, mode string) error {
+	return usageErrorf("SSL options are not supported by driver: %s", db.Driver)
+}
@@ -0,0 +1,63 @@
+package masterimport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSSLMode(t *testing.T) {
+	tests := []struct {
+		db   Database
+		want string
+	}{
+		{Database{}, ""},
+		{Database{SSLMode: "required"}, SSLModeRequired},
+		{Database{SSLCA: "ca.pem"}, SSLModeVerifyCA},
+		{Database{SSLCert: "cert.pem", SSLKey: "key.pem"}, SSLModeRequired},
+		{Database{SSLMode: "DISABLED", SSLCA: "ca.pem"}, SSLModeDisabled},
+	}
+
+	for _, test := range tests {
+		got, err := test.db.sslMode()
+		if err != nil {
+			t.Errorf("%+v: %s", test.db, err)
+		} else if got != test.want {
+			t.Errorf("%+v: mode = %q, want %q", test.db, got, test.want)
+		}
+	}
+
+	db := Database{SSLMode: "VERIFY"}
+	if _, err := db.sslMode(); err == nil {
+		t.Error("expected an error for an invalid SSL mode")
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	tests := []struct {
+		db      Database
+		dialect Dialect
+		want    map[string]string
+	}{
+		{Database{Driver: "mysql"}, MySQLDialect{}, nil},
+		{Database{Driver: "mysql", SSLMode: SSLModeDisabled}, MySQLDialect{}, map[string]string{"tls": "false"}},
+		{Database{Driver: "mysql", SSLMode: SSLModeRequired}, MySQLDialect{}, map[string]string{"tls": tlsConfigName}},
+		{
+			Database{Driver: "postgres", SSLCA: "ca.pem", SSLKey: "key.pem"},
+			PostgresDialect{},
+			map[string]string{"sslmode": "verify-ca", "sslrootcert": "ca.pem", "sslkey": "key.pem"},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.db.configureTLS(test.dialect); err != nil {
+			t.Errorf("%s: %s", test.db.Driver, err)
+		} else if !reflect.DeepEqual(test.db.Params, test.want) {
+			t.Errorf("%s: params = %v, want %v", test.db.Driver, test.db.Params, test.want)
+		}
+	}
+
+	db := Database{Driver: "sqlite3", SSLMode: SSLModeRequired}
+	if err := db.configureTLS(SQLiteDialect{}); err == nil {
+		t.Error("expected an error for SSL options with SQLite")
+	}
+}
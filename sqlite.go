@@ -0,0 +1,8 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+// The SQLite driver needs cgo, so binaries built without it support MySQL
+// and PostgreSQL only.
+import _ "github.com/mattn/go-sqlite3"